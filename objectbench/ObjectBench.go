@@ -2,51 +2,179 @@ package main
 
 import (
 	"encoding/csv"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"io"
 	"io/ioutil"
-	"math"
 	"math/rand"
 	"net"
 	"net/rpc"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type ObjectBenchService int
 type Args struct {
 	WorkRequest string
+	Controller  string
+	Node        string
 }
 
+var emitMu sync.Mutex
+
 func (t *ObjectBenchService) Emit(args *Args, reply *int) error {
-	prepareJobs([]byte(args.WorkRequest))
+	emitMu.Lock()
+	defer emitMu.Unlock()
+	jobs, err := parseJobs([]byte(args.WorkRequest))
+	if err != nil {
+		return err
+	}
+
+	if args.Controller != "" {
+		client, err := rpc.Dial("tcp", args.Controller)
+		if err != nil {
+			return err
+		}
+
+		defer client.Close()
+		startPublisher(client, args.Node)
+		defer stopPublisher()
+	}
+
+	runJobs(jobs)
 	*reply = 0
 	return nil
 }
 
-func (t *ObjectBenchService) Publish(args *Result, reply *int) error {
+func (t *ObjectBenchService) Publish(args *Batch, reply *int) error {
+	if collector != nil {
+		collector.add(args)
+	}
+
 	*reply = 0
 	return nil
 }
 
+type OpCounter struct {
+	Ops    int64
+	Bytes  int64
+	Errors int64
+}
+
 type Overview struct {
 	OpsTotal   int64
 	BytesTotal int64
 	Elapsed    int64
+	Operations map[string]*OpCounter
+	Nodes      map[string]*OpCounter
+	Dropped    map[string]int64
 	mu         sync.Mutex
 }
 
-var overall Overview
+var overall = Overview{Operations: make(map[string]*OpCounter), Nodes: make(map[string]*OpCounter), Dropped: make(map[string]int64)}
+
+func (ov *Overview) counter(op string) *OpCounter {
+	c, ok := ov.Operations[op]
+	if !ok {
+		c = &OpCounter{}
+		ov.Operations[op] = c
+	}
+
+	return c
+}
+
+func (ov *Overview) count(op string, bytes int64) {
+	ov.mu.Lock()
+	ov.BytesTotal += bytes
+	ov.OpsTotal++
+	c := ov.counter(op)
+	c.Ops++
+	c.Bytes += bytes
+	ov.mu.Unlock()
+}
+
+func (ov *Overview) fail(op string) {
+	ov.mu.Lock()
+	ov.counter(op).Errors++
+	ov.mu.Unlock()
+}
+
+func (ov *Overview) reset() {
+	ov.mu.Lock()
+	ov.OpsTotal = 0
+	ov.BytesTotal = 0
+	ov.Elapsed = 0
+	ov.Operations = make(map[string]*OpCounter)
+	ov.Nodes = make(map[string]*OpCounter)
+	ov.Dropped = make(map[string]int64)
+	ov.mu.Unlock()
+}
+
+func (ov *Overview) tick() {
+	ov.mu.Lock()
+	ov.Elapsed++
+	obytes := ov.BytesTotal
+	oops := ov.OpsTotal
+	bytes := bytesToUnits(int64(float64(ov.BytesTotal) / float64(ov.Elapsed)))
+	ops := float64(ov.OpsTotal) / float64(ov.Elapsed)
+	seconds := ov.Elapsed
+	nodes := ""
+	for _, name := range sortedNames(ov.Nodes) {
+		nodes += fmt.Sprintf(",%s=%.2f", name, float64(ov.Nodes[name].Ops)/float64(ov.Elapsed))
+	}
+	ov.mu.Unlock()
+	fmt.Printf("%d,%d,%d,%d,%.2f,%s/s%s\n", time.Now().UnixNano()/1000000000, seconds, oops, obytes, ops, bytes, nodes)
+}
+
+func (ov *Overview) printOperations() {
+	ov.mu.Lock()
+	defer ov.mu.Unlock()
+	printCounters("operation", ov.Operations, ov.Elapsed)
+	if len(ov.Nodes) > 0 {
+		printCounters("node", ov.Nodes, ov.Elapsed)
+	}
+
+	if len(ov.Dropped) > 0 {
+		names := make([]string, 0, len(ov.Dropped))
+		for name := range ov.Dropped {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		fmt.Println("node,dropped")
+		for _, name := range names {
+			fmt.Printf("%s,%d\n", name, ov.Dropped[name])
+		}
+	}
+}
+
+func printCounters(kind string, counters map[string]*OpCounter, elapsed int64) {
+	fmt.Printf("%s,ops,errors,bytes,ops/s,bytes/s\n", kind)
+	for _, name := range sortedNames(counters) {
+		c := counters[name]
+		ops := float64(c.Ops) / float64(elapsed)
+		bytes := bytesToUnits(int64(float64(c.Bytes) / float64(elapsed)))
+		fmt.Printf("%s,%d,%d,%d,%.2f,%s/s\n", name, c.Ops, c.Errors, c.Bytes, ops, bytes)
+	}
+}
+
+func sortedNames(counters map[string]*OpCounter) []string {
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
 
 type Result struct {
 	Err          string `json:"err"`
@@ -59,6 +187,20 @@ type Result struct {
 	TransferRate string `json:"transferrate"`
 	StartTime    int64  `json:"starttime"`
 	EndTime      int64  `json:"endtime"`
+	Operation    string `json:"operation"`
+	Node         string `json:"node"`
+	Bytes        int64  `json:"bytes"`
+	LatencyNs    int64  `json:"latency_ns"`
+	UploadNs     int64  `json:"uploadtime_ns"`
+	LagNs        int64  `json:"lag_ns"`
+	ErrClass     string `json:"errclass"`
+	Status       int    `json:"status"`
+	RequestId    string `json:"requestid"`
+	Keys         int64  `json:"keys"`
+	Target       string `json:"target"`
+	VersionId    string `json:"version_id"`
+	parts        []Result
+	part         bool
 }
 
 func (r *Result) ResultArray() []string {
@@ -73,69 +215,138 @@ func (r *Result) ResultArray() []string {
 		r.TransferRate,
 		fmt.Sprintf("%v", r.StartTime),
 		fmt.Sprintf("%v", r.EndTime),
+		r.Operation,
+		r.Node,
+		fmt.Sprintf("%v", r.Bytes),
+		r.ErrClass,
+		r.Target,
+		r.VersionId,
 	}
 }
 
-type RPCJob struct {
-	Controller  string `json:"controller"`
-	Region      string `json:"region"`
-	Endpoint    string `json:"endpoint"`
-	Profile     string `json:"profile"`
-	Pathstyle   bool   `json:"pathstyle"`
-	Nossl       bool   `json:"nossl"`
-	Nomd5       bool   `json:"nomd5"`
-	Nosum       bool   `json:"nosum"`
-	Retries     int    `json:"retries"`
-	Bucket      string `json:"bucket"`
-	Keyprefix   string `json:"keyprefix"`
-	Objectsize  string `json:"objectsize"`
-	osize       int64
-	Concurrency int    `json:"concurrency"`
-	Partsize    string `json:"partsize"`
-	psize       int64
-	Maxparts    int    `json:"maxparts"`
-	Delparts    bool   `json:"delparts"`
-	Workers     int    `json:"workers"`
-	Errorlog    string `json:"errorlog"`
-	Results     string `json:"results"`
-	Count       int64  `json:"count"`
-}
-
 type Job struct {
-	Bucket      string `json:"bucket"`
-	Keyprefix   string `json:"keyprefix"`
-	Objectsize  string `json:"objectsize"`
-	osize       int64
-	Concurrency int    `json:"concurrency"`
-	Partsize    string `json:"partsize"`
-	psize       int64
-	Maxparts    int    `json:"maxparts"`
-	Delparts    bool   `json:"delparts"`
-	Workers     int    `json:"workers"`
-	Errorlog    string `json:"errorlog"`
-	Results     string `json:"results"`
-	Count       int64  `json:"count"`
-	mu          sync.Mutex
+	Operation       string         `json:"operation"`
+	Bucket          string         `json:"bucket"`
+	Keyprefix       string         `json:"keyprefix"`
+	Objectsize      string         `json:"objectsize"`
+	Concurrency     int            `json:"concurrency"`
+	Partsize        string         `json:"partsize"`
+	Maxparts        int            `json:"maxparts"`
+	Delparts        bool           `json:"delparts"`
+	Workers         int            `json:"workers"`
+	Errorlog        string         `json:"errorlog"`
+	Results         string         `json:"results"`
+	Count           int64          `json:"count"`
+	Mix             map[string]int `json:"mix"`
+	Existing        int64          `json:"existing"`
+	Seed            int64          `json:"seed"`
+	Checksum        bool           `json:"checksum"`
+	Duration        string         `json:"duration"`
+	Warmup          string         `json:"warmup"`
+	Rampup          string         `json:"rampup"`
+	RateOps         float64        `json:"rate_ops"`
+	RateBytes       string         `json:"rate_bytes"`
+	Target          string         `json:"target"`
+	Region          string         `json:"region"`
+	Endpoint        string         `json:"endpoint"`
+	Profile         string         `json:"profile"`
+	AccessKey       string         `json:"accesskey"`
+	SecretKey       string         `json:"secretkey"`
+	Anonymous       bool           `json:"anonymous"`
+	Pathstyle       *bool          `json:"pathstyle"`
+	Nossl           *bool          `json:"nossl"`
+	Nomd5           *bool          `json:"nomd5"`
+	Nosum           *bool          `json:"nosum"`
+	Retries         *int           `json:"retries"`
+	AbortPct        float64        `json:"abort_pct"`
+	IncompletePct   float64        `json:"incomplete_pct"`
+	Depth           int            `json:"depth"`
+	Fanout          int            `json:"fanout"`
+	LeafObjects     int            `json:"leaf_objects"`
+	PageSize        int            `json:"pagesize"`
+	Cleanup         bool           `json:"cleanup"`
+	CleanupWorkers  int            `json:"cleanup_workers"`
+	Name            string         `json:"name"`
+	Stage           int            `json:"stage"`
+	After           string         `json:"after"`
+	From            string         `json:"from"`
+	Compressibility float64        `json:"compressibility"`
+	Dedupe          float64        `json:"dedupe"`
+	DedupeBlock     string         `json:"dedupe_block"`
+	Encryption      string         `json:"encryption"`
+	KmsKeyId        string         `json:"kms_key_id"`
+	StorageClass    string         `json:"storage_class"`
+	ACL             string         `json:"acl"`
+	ContentType     string         `json:"content_type"`
+	Tagging         string         `json:"tagging"`
+	MetadataHeaders int            `json:"metadata_headers"`
+	MetadataSize    string         `json:"metadata_size"`
+	KeyStrategy     string         `json:"key_strategy"`
+	Zipf            float64        `json:"zipf"`
+	Versions        *int           `json:"versions"`
+	Versioning      bool           `json:"versioning"`
+	osize           int64
+	sizes           Sizer
+	psize           int64
+	duration        time.Duration
+	warmup          time.Duration
+	rampup          time.Duration
+	rateBytes       int64
+	payload         *Payload
+	userMetadata    map[string]*string
+	zipf            *rand.Zipf
+	mixOps          []string
+	mixWeights      []int
+	keys            *Keyspace
+	input           *Keyspace
+	output          *Keyspace
+	start           time.Time
+	measured        time.Time
+	stop            time.Time
+	finished        time.Time
+	issued          int64
+	slot            time.Time
+	lag             *Histogram
+	done            int64
+	stats           map[string]*OpStats
+	interval        map[string]*OpStats
+	errClasses      map[string]int64
+	statsMu         sync.Mutex
+	uploads         map[string]bool
+	uploadCheck     *UploadCheck
+	cleanupSummary  *CleanupSummary
+	uploadsMu       sync.Mutex
+	errlog          *os.File
+	logMu           sync.Mutex
+	mu              sync.Mutex
+	sess            *session.Session
+	svc             *s3.S3
+	keepVersions    int
+	versionIds      map[string]*keyVersions
+	versionsMu      sync.Mutex
 }
 
 type ObjectInputStream struct {
 	Size      int64
 	Pos       int64
+	Seed      uint64
+	Payload   *Payload
 	FirstByte bool
 	StartTs   time.Time
 	CurrentTs time.Time
 }
 
-func NewObjectInputStream(size int64) (o *ObjectInputStream) {
+func NewObjectInputStream(size int64, seed uint64, payload *Payload) (o *ObjectInputStream) {
 	return &ObjectInputStream{
 		Size:      size,
 		Pos:       0,
+		Seed:      seed,
+		Payload:   payload,
 		FirstByte: true,
 	}
 }
 
 func (cin *ObjectInputStream) Read(b []byte) (n int, err error) {
-	var copied int64 = 0
 	if cin.Pos >= cin.Size {
 		return 0, io.EOF
 	}
@@ -145,52 +356,72 @@ func (cin *ObjectInputStream) Read(b []byte) (n int, err error) {
 		cin.StartTs = time.Now()
 	}
 
-	for cin.Pos < cin.Size {
-		var sz int64 = cin.Size - cin.Pos
-		if sz > 8000000 {
-			sz = 8000000
-		}
-
-		buffer := make([]byte, sz)
-		_, _ = rand.Read(buffer)
-		copied = copy(b, buffer)
-	
-		cin.Pos += int64(copied)
+	if int64(len(b)) > cin.Size-cin.Pos {
+		b = b[:cin.Size-cin.Pos]
 	}
 
+	cin.Payload.Fill(cin.Seed, cin.Pos, b)
+	cin.Pos += int64(len(b))
 	cin.CurrentTs = time.Now()
-	n = copied
-	return
+	return len(b), nil
 }
 
 func (cin *ObjectInputStream) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
 	case io.SeekStart:
-		if offset > cin.Size || (cin.Size+offset) < 0 {
+		if offset > cin.Size || offset < 0 {
 			return 0, io.EOF
 		} else {
 			cin.Pos = offset
-			return offset, nil
+			return cin.Pos, nil
 		}
 	case io.SeekCurrent:
-		if (cin.Pos+offset) > cin.Size || (cin.Size+offset) < 0 {
+		if (cin.Pos+offset) > cin.Size || (cin.Pos+offset) < 0 {
 			return 0, io.EOF
 		} else {
 			cin.Pos += offset
-			return offset, nil
+			return cin.Pos, nil
 		}
 	case io.SeekEnd:
 		if (cin.Size+offset) > cin.Size || (cin.Size+offset) < 0 {
 			return 0, io.EOF
 		} else {
-			cin.Pos += offset
-			return offset, nil
+			cin.Pos = cin.Size + offset
+			return cin.Pos, nil
 		}
 	}
 
 	return 0, nil
 }
 
+type ObjectOutputStream struct {
+	Size      int64
+	FirstByte bool
+	StartTs   time.Time
+	CurrentTs time.Time
+	mu        sync.Mutex
+}
+
+func NewObjectOutputStream() (o *ObjectOutputStream) {
+	return &ObjectOutputStream{
+		Size:      0,
+		FirstByte: true,
+	}
+}
+
+func (cout *ObjectOutputStream) WriteAt(b []byte, off int64) (n int, err error) {
+	cout.mu.Lock()
+	defer cout.mu.Unlock()
+	if cout.FirstByte {
+		cout.FirstByte = false
+		cout.StartTs = time.Now()
+	}
+
+	cout.Size += int64(len(b))
+	cout.CurrentTs = time.Now()
+	return len(b), nil
+}
+
 var region = flag.String("region", "us-east-2", "Region name to be used")
 var endpoint = flag.String("endpoint", "", "Overwrite the endpoint")
 var profile = flag.String("profile", "default", "The profile name")
@@ -199,7 +430,8 @@ var nossl = flag.Bool("nossl", false, "Don't use SSL")
 var nomd5 = flag.Bool("nomd5", false, "Disable adding ContentMD5 to S3 object put and uploads")
 var nosum = flag.Bool("nosum", false, "Disable creating checksums")
 var retries = flag.Int("retries", -1, "Set the number of retries default -1 (forever)")
-var cfg = flag.String("config", "objectbench.json", "config file in json format default objectbench.json")
+var cfg = flag.String("config", "objectbench.json", "config file in json or yaml format default objectbench.json")
+var sequential = flag.Bool("sequential", false, "Run the jobs one after the other instead of in parallel stages")
 var skeleton = flag.Bool("skeleton", false, "Print a configuration example to stdout")
 var service = flag.Bool("service", false, "Run as a service, expecting rpc requests on 18088")
 var controllerOf = flag.String("controller", "", "comma separated list of ip addresses or names of objectbench services running on port 18088")
@@ -217,10 +449,27 @@ func usage() {
 	fmt.Println("\t-nomd5      Disable adding ContentMD5 to S3 object put and upload")
 	fmt.Println("\t-nosum      Disable creating checksums")
 	fmt.Println("\t-retries    Set the number of retries default -1 forever")
-	fmt.Println("\t-config     Path to config file")
+	fmt.Println("\t-config     Path to config file in json or yaml, lists of values expand to a job per")
+	fmt.Println("\t            combination and ${VAR} is replaced by the environment variable VAR")
+	fmt.Println("\t-sequential Run the jobs one after the other instead of in parallel stages")
+	fmt.Println("\t-percentiles Print latency percentiles per job and operation every second")
+	fmt.Println("\t-metrics    <address> Serve Prometheus metrics on http://<address>/metrics e.g. :9100")
+	fmt.Println("\t-local-s3   Run against an embedded in-memory S3 server, -endpoint is set to it")
+	fmt.Println("\t-local-s3-listen <address> Address of the embedded S3 server default 127.0.0.1:0")
+	fmt.Println("\t-local-s3-latency <duration> Latency added to every request of the embedded S3 server")
+	fmt.Println("\t-local-s3-errors <fraction> Fraction of requests failed with SlowDown or InternalError")
+	fmt.Println("\t-cleanup    Only delete the objects and multipart uploads under the keyprefix of every job")
 	fmt.Println("\t-skeleton   Print a configuration file example to stdout and exit")
 	fmt.Println("\t-service    Run as a service expecting rpc requests on port 18088")
 	fmt.Println("\t-controller ip addresses or names of objectbench services running on port 18088")
+	fmt.Println("\t-listen     <address> The controller listens here for results published by the services default :18089")
+	fmt.Println("\t-merged     <file> The controller writes the results of all services to this csv file")
+	fmt.Println()
+	fmt.Println("Use", os.Args[0], "report [-format html|md] [-o file] <results.csv...>")
+	fmt.Println("\t            Write an html or markdown report of results files")
+	fmt.Println("Use", os.Args[0], "compare [-threshold percent] [-json file] [-allow-missing] <baseline> <current>")
+	fmt.Println("\t            Compare the summaries of two runs, exits with 2 on a regression and")
+	fmt.Println("\t            with 3 if a job or operation of the baseline is missing")
 	fmt.Println()
 }
 
@@ -284,122 +533,158 @@ func unitsToBytes(u string) (r int64, err error) {
 		} else {
 			return 0, errors.New("Failed to parse number")
 		}
+	} else if u == "" {
+		return 0, nil
 	}
 
-	return 0, nil
+	result, err := strconv.ParseInt(u, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown size %q, use a number and a unit of B, K, M, G or T", u)
+	}
+
+	return result, nil
 }
 
 func prepareJobs(rawjson []byte) {
-	var jobs []Job
-	err := json.Unmarshal(rawjson, &jobs)
+	jobs, err := parseJobs(rawjson)
 	if err != nil {
-		exitErrorf("Error parsing json %v", err)
+		exitErrorf("%v", err)
 	}
 
-	if *controllerOf != "" {
-		netService := new(ObjectBenchService)
-		rpc.Register(netService)
-		listener, err := net.Listen("tcp", ":18088")
+	runJobs(jobs)
+}
+
+func runJobs(jobs []Job) {
+	var err error
+	overall.reset()
+	resetStarted()
+	for j := range jobs {
+		fmt.Println("Objectsize", jobs[j].Objectsize, "osize", jobs[j].osize)
+		fmt.Println("Job ", jobs[j].Operation, jobs[j].Bucket, jobs[j].Keyprefix, jobs[j].Objectsize, jobs[j].osize, jobs[j].psize)
+	}
+
+	sessions := make(map[string]*session.Session)
+	for j := range jobs {
+		jobs[j].sess, err = jobs[j].session(sessions)
 		if err != nil {
-			exitErrorf("RPC Error %v\n", err)
-			return
+			exitErrorf("Unable to create session %v", err)
 		}
+	}
 
-		rpc.Accept(listener)
+	if *cleanupMode {
+		cleanupJobs(jobs)
+		return
 	}
 
-	for j, _ := range jobs {
-		if jobs[j].Workers == 0 {
-			jobs[j].Workers = 1
-		}
+	var cchan = make(chan bool)
+	rwg.Add(1)
+	go reportOverview(cchan)
 
-		jobs[j].osize, err = unitsToBytes(jobs[j].Objectsize)
-		if err != nil {
-			exitErrorf("Error parsing json %v", err)
-		}
-		fmt.Println("Objectsize", jobs[j].Objectsize, "osize", jobs[j].osize)
+	var summaries []StageSummary
+	for _, stage := range stages(jobs) {
+		summaries = append(summaries, runStage(stage))
+	}
 
-		jobs[j].psize, err = unitsToBytes(jobs[j].Partsize)
-		if err != nil {
-			exitErrorf("Error parsing json %v", err)
+	cchan <- true
+	rwg.Wait()
+	overall.printOperations()
+	if len(summaries) > 1 {
+		printStages(summaries)
+	}
+
+	for j := range jobs {
+		jobs[j].writeSummary()
+	}
+}
+
+func startJobs(jobs []*Job) {
+	setRunning(jobs)
+	for _, job := range jobs {
+		gwg.Add(1)
+		go startJob(job.sess, job)
+	}
+
+	gwg.Wait()
+}
+
+// The totals only start once every running job is past its warm-up.
+func warmingUp() bool {
+	jobs := runningJobs()
+	if len(jobs) == 0 {
+		return false
+	}
+
+	for _, job := range jobs {
+		if !job.warmingUp() {
+			return false
 		}
+	}
+
+	return true
+}
 
-		if jobs[j].psize != 0 {
-			pb, _ := unitsToBytes("5M")
-			if jobs[j].psize < pb {
-				jobs[j].psize, _ = unitsToBytes("5M")
-				fmt.Println("Ignoring part size, min 5M will be used now")
+func reportOverview(cchan chan bool) {
+	for {
+		select {
+		case <-cchan:
+			overall.tick()
+			rwg.Done()
+			return
+		case <-time.After(1 * time.Second):
+			if warmingUp() {
+				fmt.Println("Warming up")
+				continue
 			}
-		}
 
-		if jobs[j].Maxparts > 0 {
-			jobs[j].psize = int64(math.Ceil(float64(jobs[j].osize) / float64(jobs[j].Maxparts)))
-			pb, _ := unitsToBytes("5M")
-			if jobs[j].psize < pb {
-				jobs[j].psize = 0
-				jobs[j].Maxparts = 0
-				fmt.Println("Ignoring the number of parts because part size is < 5M")
+			overall.tick()
+			if *percentiles {
+				for _, job := range runningJobs() {
+					job.printInterval()
+				}
 			}
 		}
-
-		fmt.Println("Job ", jobs[j].Bucket, jobs[j].Keyprefix, jobs[j].Objectsize, jobs[j].osize, jobs[j].psize)
 	}
+}
 
-	config := aws.NewConfig().
-		WithCredentials(credentials.NewSharedCredentials("", *profile)).
-		WithEndpoint(*endpoint).
-		WithRegion(*region).
-		WithDisableSSL(*nossl).
-		WithMaxRetries(*retries).
-		WithDisableComputeChecksums(*nosum).
-		WithS3DisableContentMD5Validation(*nomd5).
-		WithS3ForcePathStyle(*pathstyle)
+// next hands out the number of the next object. With a duration the job runs
+// until it is over, cycling through count objects if a count is given too.
+// With zipf the number is a hot spot pick of the count objects instead.
+func (job *Job) next() (int64, bool) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.duration > 0 {
+		if time.Now().After(job.stop) {
+			return 0, false
+		}
 
-	sess, err := session.NewSession(config)
-	if err != nil {
-		exitErrorf("Unable to create session %v", err)
-	}
+		job.issued++
+		if job.zipf != nil {
+			return int64(job.zipf.Uint64()) + 1, true
+		}
 
-	var cchan = make(chan bool)
-	rwg.Add(1)
-	go func() {
-		for {
-			select {
-			case <-cchan:
-				overall.mu.Lock()
-				overall.Elapsed++
-				obytes := overall.BytesTotal
-				oops := overall.OpsTotal
-				bytes := bytesToUnits(int64(float64(overall.BytesTotal) / float64(overall.Elapsed)))
-				ops := float64(overall.OpsTotal) / float64(overall.Elapsed)
-				seconds := overall.Elapsed
-				overall.mu.Unlock()
-				fmt.Printf("%d,%d,%d,%d,%.2f,%s/s\n", time.Now().UnixNano()/1000000000, seconds, oops, obytes, ops, bytes)
-				rwg.Done()
-				break
-			case <-time.After(1 * time.Second):
-				overall.mu.Lock()
-				overall.Elapsed++
-				obytes := overall.BytesTotal
-				oops := overall.OpsTotal
-				bytes := bytesToUnits(int64(float64(overall.BytesTotal) / float64(overall.Elapsed)))
-				ops := float64(overall.OpsTotal) / float64(overall.Elapsed)
-				seconds := overall.Elapsed
-				overall.mu.Unlock()
-				fmt.Printf("%d,%d,%d,%d,%.2f,%s/s\n", time.Now().UnixNano()/1000000000, seconds, oops, obytes, ops, bytes)
-			}
+		if job.Count > 0 {
+			return job.Count - (job.issued-1)%job.Count, true
 		}
-	}()
 
-	for _, j := range jobs {
-		gwg.Add(1)
-		go startJob(sess, &j)
+		return job.issued, true
 	}
 
-	gwg.Wait()
-	cchan <- true
-	rwg.Wait()
+	if job.issued >= job.Count*job.rounds() {
+		return 0, false
+	}
 
+	job.issued++
+	if job.zipf != nil {
+		return int64(job.zipf.Uint64()) + 1, true
+	}
+
+	return job.Count - (job.issued-1)%job.Count, true
+}
+
+func (job *Job) warmingUp() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.start.IsZero() || time.Now().Before(job.measured)
 }
 
 func startJob(session *session.Session, job *Job) {
@@ -411,6 +696,17 @@ func startJob(session *session.Session, job *Job) {
 	rchan := make(chan Result)
 	cchan := make(chan bool)
 	cv = sync.NewCond(&mu)
+	job.sess = session
+	job.svc = s3.New(session)
+	if job.Versioning {
+		job.enableVersioning()
+	} else if job.Operation == "versions" || job.Mix["versions"] > 0 {
+		job.checkVersioning()
+	}
+
+	if job.Zipf > 0 && job.keys == nil && job.Count > 1 {
+		job.zipf = rand.NewZipf(rand.New(rand.NewSource(rand.Int63())), job.Zipf, 1, uint64(job.Count-1))
+	}
 
 	go func() {
 		f, err := os.OpenFile(job.Results, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -423,8 +719,13 @@ func startJob(session *session.Session, job *Job) {
 		for {
 			select {
 			case <-cchan:
-				break
+				return
 			case result := <-rchan:
+				job.record(result)
+				if result.Err != "ok" && result.ErrClass != "" {
+					job.logFailure(result)
+				}
+
 				if err := w.Write(result.ResultArray()); err != nil {
 					fmt.Printf("Error writing %s: %v\n", job.Results, err)
 				}
@@ -433,6 +734,8 @@ func startJob(session *session.Session, job *Job) {
 				if w.Error() != nil {
 					fmt.Printf("Error writing %s: %v\n", job.Results, w.Error())
 				}
+
+				publish(result)
 			}
 		}
 	}()
@@ -447,80 +750,85 @@ func startJob(session *session.Session, job *Job) {
 			}
 			mu.Unlock()
 
+			if job.rampup > 0 {
+				time.Sleep(job.rampup * time.Duration(nr) / time.Duration(job.Workers))
+			}
+
+			op := operations[job.Operation]
 			for {
-				job.mu.Lock()
-				current := job.Count
-				job.Count--
-				job.mu.Unlock()
-				if current > 0 {
-					t := time.Now()
-					o := NewObjectInputStream(job.osize)
-					bucket := job.Bucket
-					filename := fmt.Sprintf("%s%d", job.Keyprefix, current)
-					// http://docs.aws.amazon.com/sdk-for-go/api/service/s3/s3manager/#NewUploader
-					uploader := s3manager.NewUploader(session, func(u *s3manager.Uploader) {
-						u.Concurrency = job.Concurrency
-						u.LeavePartsOnError = job.Delparts
-						if job.Maxparts > 0 {
-							u.MaxUploadParts = job.Maxparts
-							u.PartSize = job.psize
-						} else {
-							if job.psize > 0 {
-								u.PartSize = job.psize
-							}
-						}
-					})
-
-					// Upload the file's body to S3 bucket as an object with the key being the
-					// same as the filename.
-					_, err := uploader.Upload(&s3manager.UploadInput{
-						Bucket: aws.String(bucket),
-						Key:    aws.String(filename),
-
-						// The file to be uploaded. io.ReadSeeker is preferred as the Uploader
-						// will be able to optimize memory when uploading large content. io.Reader
-						// is supported, but will require buffering of the reader's bytes for
-						// each part.
-						Body: o,
-					})
-
-					if err != nil {
-						rchan <- Result{Err: fmt.Sprintf("Unable to upload %q to %q, %v", filename, bucket, err)}
+				current, ok := job.next()
+				if !ok {
+					break
+				}
+
+				t := time.Now()
+				if job.openLoop() {
+					t = job.schedule(int64(job.sizes.Mean()))
+					time.Sleep(time.Until(t))
+				}
+
+				lag := time.Since(t)
+				var r Result
+				if job.keys != nil {
+					r = job.mixed()
+				} else {
+					r = op(job, job.key(current))
+				}
+
+				if job.openLoop() {
+					r.delay(t, lag)
+				}
+
+				if job.output != nil && job.keys == nil && r.Err == "ok" && r.Operation == job.Operation {
+					job.output.Written(r.Object)
+				}
+
+				if t.Before(job.measured) {
+					continue
+				}
+
+				atomic.AddInt64(&job.done, 1)
+
+				for i, part := range append(r.parts, r) {
+					part.Target = job.Target
+					part.part = i < len(r.parts)
+					if part.Err == "ok" {
+						overall.count(part.Operation, part.Bytes)
 					} else {
-						overall.mu.Lock()
-						overall.BytesTotal += o.Size
-						overall.OpsTotal++
-						overall.mu.Unlock()
-						ptime := (o.CurrentTs.Sub(o.StartTs).Seconds())
-						utime := (time.Now().Sub(o.StartTs).Seconds())
-						rate := int64((float64(o.Pos)) / utime)
-						latency := o.StartTs.Sub(t).Seconds() * 1000
-						r := Result{
-							Err:          "ok",
-							Bucket:       job.Bucket,
-							Object:       filename,
-							ObjectSize:   bytesToUnits(o.Size),
-							Latency:      fmt.Sprintf("%vms", latency),
-							ProcessTime:  fmt.Sprintf("%vs", ptime),
-							UploadTime:   fmt.Sprintf("%vs", utime),
-							TransferRate: fmt.Sprintf("%s/s", bytesToUnits(rate)),
-							StartTime:    t.UnixNano(),
-							EndTime:      time.Now().UnixNano(),
-						}
-						rchan <- r
+						overall.fail(part.Operation)
 					}
-				} else {
-					break
+
+					rchan <- part
 				}
 			}
 		}(i)
 	}
 
 	mu.Lock()
+	job.mu.Lock()
+	job.start = time.Now()
+	job.measured = job.start.Add(job.warmup)
+	if job.duration > 0 {
+		job.stop = job.measured.Add(job.duration)
+	}
+	job.mu.Unlock()
 	ready = true
 	mu.Unlock()
 	cv.Broadcast()
 	wg.Wait()
+	job.finished = time.Now()
+	if job.uploads != nil {
+		job.checkUploads()
+	}
+
+	if job.Cleanup {
+		c := job.cleanup()
+		job.statsMu.Lock()
+		job.cleanupSummary = c
+		job.statsMu.Unlock()
+	}
+
+	job.closeErrorlog()
 	cchan <- true
 }
 
@@ -534,7 +842,36 @@ func main() {
 		return
 	}
 
-	if *service {
+	if *skeleton {
+		fmt.Print(skeletonConfig)
+		return
+	}
+
+	switch flag.Arg(0) {
+	case "report":
+		runReport(flag.Args()[1:])
+		return
+	case "compare":
+		runCompare(flag.Args()[1:])
+		return
+	}
+
+	if *metrics != "" {
+		serveMetrics(*metrics)
+	}
+
+	if *localS3 {
+		startLocalS3()
+	}
+
+	if *controllerOf != "" {
+		rawjson, err := ioutil.ReadFile(*cfg)
+		if err != nil {
+			exitErrorf("Error reading config %v", err)
+		}
+
+		runController(rawjson)
+	} else if *service {
 		netService := new(ObjectBenchService)
 		rpc.Register(netService)
 		listener, err := net.Listen("tcp", ":18088")
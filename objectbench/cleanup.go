@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var cleanupMode = flag.Bool("cleanup", false, "Only delete the objects and multipart uploads under the prefix of every job")
+
+type CleanupSummary struct {
+	Deleted int64   `json:"deleted"`
+	Batches int64   `json:"batches"`
+	Errors  int64   `json:"errors"`
+	Aborted int64   `json:"aborted"`
+	Seconds float64 `json:"seconds"`
+	Err     string  `json:"error,omitempty"`
+}
+
+// cleanup deletes everything below the job's Keyprefix with DeleteObjects
+// batches of up to 1000 keys, sent by CleanupWorkers workers, and aborts the
+// multipart uploads left below it. In a versioned bucket a delete without a
+// version only adds a delete marker, so there every version and delete marker
+// is deleted by its version id.
+func (job *Job) cleanup() *CleanupSummary {
+	c := &CleanupSummary{}
+	workers := job.CleanupWorkers
+	if workers <= 0 {
+		workers = 8
+	}
+
+	var mu sync.Mutex
+	fail := func(err error) {
+		mu.Lock()
+		if c.Err == "" {
+			c.Err = err.Error()
+		}
+		mu.Unlock()
+	}
+
+	t := time.Now()
+	batches := make(chan []*s3.ObjectIdentifier)
+	uploads := make(chan *s3.MultipartUpload)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				out, err := job.svc.DeleteObjects(&s3.DeleteObjectsInput{
+					Bucket: aws.String(job.Bucket),
+					Delete: &s3.Delete{Objects: batch, Quiet: aws.Bool(true)},
+				})
+
+				atomic.AddInt64(&c.Batches, 1)
+				if err != nil {
+					atomic.AddInt64(&c.Errors, int64(len(batch)))
+					fail(err)
+					continue
+				}
+
+				atomic.AddInt64(&c.Deleted, int64(len(batch)-len(out.Errors)))
+				atomic.AddInt64(&c.Errors, int64(len(out.Errors)))
+				if len(out.Errors) > 0 {
+					fail(fmt.Errorf("%s: %s", aws.StringValue(out.Errors[0].Code), aws.StringValue(out.Errors[0].Message)))
+				}
+			}
+
+			for u := range uploads {
+				_, err := job.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+					Bucket:   aws.String(job.Bucket),
+					Key:      u.Key,
+					UploadId: u.UploadId,
+				})
+
+				if err != nil {
+					atomic.AddInt64(&c.Errors, 1)
+					fail(err)
+					continue
+				}
+
+				atomic.AddInt64(&c.Aborted, 1)
+			}
+		}()
+	}
+
+	versioning, err := job.svc.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String(job.Bucket)})
+	if err != nil {
+		fail(err)
+	}
+
+	if err == nil && aws.StringValue(versioning.Status) != "" {
+		err = job.svc.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+			Bucket: aws.String(job.Bucket),
+			Prefix: aws.String(job.Keyprefix),
+		}, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+			batch := make([]*s3.ObjectIdentifier, 0, len(page.Versions)+len(page.DeleteMarkers))
+			for _, v := range page.Versions {
+				batch = append(batch, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+			}
+
+			for _, m := range page.DeleteMarkers {
+				batch = append(batch, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+			}
+
+			if len(batch) > 0 {
+				batches <- batch
+			}
+
+			return true
+		})
+	} else {
+		err = job.svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+			Bucket: aws.String(job.Bucket),
+			Prefix: aws.String(job.Keyprefix),
+		}, func(page *s3.ListObjectsV2Output, last bool) bool {
+			batch := make([]*s3.ObjectIdentifier, 0, len(page.Contents))
+			for _, o := range page.Contents {
+				batch = append(batch, &s3.ObjectIdentifier{Key: o.Key})
+			}
+
+			if len(batch) > 0 {
+				batches <- batch
+			}
+
+			return true
+		})
+	}
+
+	close(batches)
+	if err != nil {
+		fail(err)
+	}
+
+	err = job.svc.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(job.Bucket),
+		Prefix: aws.String(job.Keyprefix),
+	}, func(page *s3.ListMultipartUploadsOutput, last bool) bool {
+		for _, u := range page.Uploads {
+			uploads <- u
+		}
+
+		return true
+	})
+
+	close(uploads)
+	if err != nil {
+		fail(err)
+	}
+
+	wg.Wait()
+	c.Seconds = time.Since(t).Seconds()
+	return c
+}
+
+func printCleanup(name string, c *CleanupSummary) {
+	fmt.Println("job,deleted,batches,errors,aborted_uploads,seconds,objects/s,error")
+	rate := 0.0
+	if c.Seconds > 0 {
+		rate = float64(c.Deleted) / c.Seconds
+	}
+
+	fmt.Printf("%s,%d,%d,%d,%d,%.3f,%.2f,%s\n", name, c.Deleted, c.Batches, c.Errors, c.Aborted, c.Seconds, rate, c.Err)
+}
+
+// cleanupJobs runs only the cleanup of every job, for -cleanup.
+func cleanupJobs(jobs []Job) {
+	for j := range jobs {
+		jobs[j].svc = s3.New(jobs[j].sess)
+		printCleanup(jobs[j].name(), jobs[j].cleanup())
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http/httptest"
+	"testing"
+)
+
+// The cleanup of a job deletes its objects in batches of 1000 keys and
+// aborts the uploads it left.
+func TestCleanup(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(0, 0))
+	defer server.Close()
+	s := runTestJobs(t,
+		on(server, map[string]interface{}{"name": "fill", "bucket": "it", "keyprefix": "cleanup/", "objectsize": "1", "workers": 8, "operation": "put", "count": 1200, "cleanup": true, "results": "fill"}),
+		on(server, map[string]interface{}{"bucket": "it", "keyprefix": "cleanup-mp/", "objectsize": "6M", "partsize": "5M", "workers": 1, "operation": "multipart", "incomplete_pct": 100, "count": 3, "cleanup": true, "results": "multipart"}),
+		on(server, map[string]interface{}{"after": "fill", "bucket": "it", "keyprefix": "cleanup", "objectsize": "1", "workers": 1, "operation": "list", "count": 1, "results": "list"}),
+	)
+
+	if c := s["fill"].Cleanup; c == nil || c.Deleted != 1200 || c.Batches != 2 || c.Errors != 0 || c.Err != "" {
+		t.Errorf("fill cleanup %+v", c)
+	}
+
+	if c := s["multipart"].Cleanup; c == nil || c.Aborted != 3 || c.Errors != 0 {
+		t.Errorf("multipart cleanup %+v", c)
+	}
+
+	expectOps(t, "list", s["list"], counts{"list": {1, 0}})
+	if l := s["list"].Listing["list"]; l != nil {
+		t.Errorf("listed %+v after the cleanup", l)
+	}
+}
+
+// -cleanup only deletes, it runs no requests.
+func TestCleanupMode(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(0, 0))
+	defer server.Close()
+	fill := on(server, map[string]interface{}{"bucket": "it", "keyprefix": "cleanup/", "objectsize": "1", "workers": 4, "operation": "put", "count": 20, "results": "fill"})
+	runTestJobs(t, fill)
+
+	*cleanupMode = true
+	raw, _ := json.Marshal([]map[string]interface{}{fill})
+	prepareJobs(raw)
+	*cleanupMode = false
+
+	s := runTestJobs(t, on(server, map[string]interface{}{"bucket": "it", "keyprefix": "cleanup/", "objectsize": "1", "workers": 1, "operation": "list", "count": 1, "results": "list"}))
+	expectOps(t, "list", s["list"], counts{"list": {1, 0}})
+	if l := s["list"].Listing["list"]; l != nil {
+		t.Errorf("listed %+v after the cleanup", l)
+	}
+}
+
+// In a versioned bucket the cleanup deletes every version.
+func TestCleanupVersions(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(0, 0))
+	defer server.Close()
+	s := runTestJobs(t,
+		on(server, map[string]interface{}{"name": "v1", "bucket": "versioned", "keyprefix": "cleanup/", "objectsize": "1K", "workers": 2, "operation": "put", "count": 5, "versioning": true, "results": "v1"}),
+		on(server, map[string]interface{}{"after": "v1", "bucket": "versioned", "keyprefix": "cleanup/", "objectsize": "1K", "workers": 2, "operation": "put", "count": 5, "cleanup": true, "results": "v2"}),
+	)
+
+	if c := s["v2"].Cleanup; c == nil || c.Deleted != 10 || c.Errors != 0 || c.Err != "" {
+		t.Errorf("cleanup %+v, expected 2 versions of 5 objects", c)
+	}
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-2"),
+		Credentials:      credentials.NewStaticCredentials("local", "local", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+	}))
+
+	out, err := s3.New(sess).ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String("versioned"), Prefix: aws.String("cleanup/")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Versions) != 0 || len(out.DeleteMarkers) != 0 {
+		t.Errorf("%d versions and %d delete markers left", len(out.Versions), len(out.DeleteMarkers))
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// loadSummaries reads a summary json or every *_summary.json of a directory
+// and returns the summaries by the name of their results file, so every job
+// of a matrix, which writes results of its own, is compared on its own.
+func loadSummaries(path string) (map[string]*Summary, error) {
+	paths := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(path, "*_summary.json"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	summaries := make(map[string]*Summary)
+	for _, p := range paths {
+		raw, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		s := &Summary{}
+		if err := json.Unmarshal(raw, s); err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+
+		summaries[strings.TrimSuffix(filepath.Base(p), "_summary.json")] = s
+	}
+
+	if len(summaries) == 0 {
+		return nil, fmt.Errorf("No summaries in %s", path)
+	}
+
+	return summaries, nil
+}
+
+// A Delta compares one metric of an operation of two runs. Throughput and
+// ops/s regress when they drop by more than the threshold, latencies when
+// they grow by more than the threshold.
+type Delta struct {
+	Job        string  `json:"job"`
+	Operation  string  `json:"operation"`
+	Metric     string  `json:"metric"`
+	Baseline   float64 `json:"baseline"`
+	Current    float64 `json:"current"`
+	Percent    float64 `json:"percent"`
+	Regression bool    `json:"regression"`
+}
+
+func compareSummaries(baseline, current map[string]*Summary, threshold float64) (deltas []Delta, missing []string) {
+	keys := make([]string, 0, len(baseline))
+	for key := range baseline {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		c, ok := current[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+
+		b := baseline[key]
+		ops := make([]string, 0, len(b.Operations))
+		for op := range b.Operations {
+			ops = append(ops, op)
+		}
+
+		sort.Strings(ops)
+		for _, op := range ops {
+			bo, co := b.Operations[op], c.Operations[op]
+			if co == nil {
+				missing = append(missing, key+" "+op)
+				continue
+			}
+
+			for _, m := range []struct {
+				metric   string
+				baseline float64
+				current  float64
+				higher   bool
+			}{
+				{"ops/s", bo.OpsPerSec, co.OpsPerSec, true},
+				{"bytes/s", bo.BytesPerSec, co.BytesPerSec, true},
+				{"p50ms", bo.Latency.P50, co.Latency.P50, false},
+				{"p90ms", bo.Latency.P90, co.Latency.P90, false},
+				{"p99ms", bo.Latency.P99, co.Latency.P99, false},
+			} {
+				if m.baseline == 0 {
+					continue
+				}
+
+				d := Delta{
+					Job:       key,
+					Operation: op,
+					Metric:    m.metric,
+					Baseline:  m.baseline,
+					Current:   m.current,
+					Percent:   (m.current - m.baseline) / m.baseline * 100,
+				}
+
+				if m.higher {
+					d.Regression = d.Percent < -threshold
+				} else {
+					d.Regression = d.Percent > threshold
+				}
+
+				deltas = append(deltas, d)
+			}
+		}
+	}
+
+	for key := range current {
+		if _, ok := baseline[key]; !ok {
+			fmt.Printf("Ignoring %s, it is not in the baseline\n", key)
+		}
+	}
+
+	return deltas, missing
+}
+
+// runCompare implements objectbench compare [-threshold percent] <baseline> <current>,
+// it exits with 2 if a metric regressed and with 3 if a job or operation of the
+// baseline is missing in the current run, unless -allow-missing.
+func runCompare(args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	threshold := flags.Float64("threshold", 10, "Percent a metric may get worse before it counts as a regression")
+	out := flags.String("json", "", "Also write the deltas to this json file")
+	allowMissing := flags.Bool("allow-missing", false, "Don't fail if jobs or operations of the baseline are missing in the current run")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		exitErrorf("Use %s compare [-threshold percent] [-json file] [-allow-missing] <baseline> <current>, each a summary json or a directory of them", os.Args[0])
+	}
+
+	if *threshold < 0 {
+		exitErrorf("Negative threshold %v", *threshold)
+	}
+
+	baseline, err := loadSummaries(flags.Arg(0))
+	if err != nil {
+		exitErrorf("Error reading baseline %v", err)
+	}
+
+	current, err := loadSummaries(flags.Arg(1))
+	if err != nil {
+		exitErrorf("Error reading current run %v", err)
+	}
+
+	// Two files are the same job, whatever their results are called.
+	if len(baseline) == 1 && len(current) == 1 && !isDir(flags.Arg(0)) && !isDir(flags.Arg(1)) {
+		for key := range baseline {
+			for _, s := range current {
+				current = map[string]*Summary{key: s}
+			}
+		}
+	}
+
+	deltas, missing := compareSummaries(baseline, current, *threshold)
+	regressions := 0
+	fmt.Println("job,operation,metric,baseline,current,delta%,regression")
+	for _, d := range deltas {
+		fmt.Printf("%s,%s,%s,%.3f,%.3f,%+.1f,%v\n", d.Job, d.Operation, d.Metric, d.Baseline, d.Current, d.Percent, d.Regression)
+		if d.Regression {
+			regressions++
+		}
+	}
+
+	for _, key := range missing {
+		fmt.Printf("Missing in the current run: %s\n", key)
+	}
+
+	if *out != "" {
+		raw, _ := json.MarshalIndent(deltas, "", "    ")
+		if err := ioutil.WriteFile(*out, raw, 0644); err != nil {
+			exitErrorf("Error writing %s: %v", *out, err)
+		}
+	}
+
+	if regressions > 0 {
+		fmt.Fprintf(os.Stderr, "%d metrics regressed by more than %v%%\n", regressions, *threshold)
+		os.Exit(2)
+	}
+
+	if len(missing) > 0 && !*allowMissing {
+		fmt.Fprintf(os.Stderr, "%d jobs or operations of the baseline are missing\n", len(missing))
+		os.Exit(3)
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
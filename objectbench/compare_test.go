@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func summaryOf(ops map[string]*OpSummary) *Summary {
+	return &Summary{Operations: ops}
+}
+
+func TestCompareSummaries(t *testing.T) {
+	baseline := map[string]*Summary{
+		"put": summaryOf(map[string]*OpSummary{
+			"put": {OpsPerSec: 100, BytesPerSec: 1000, Latency: Percentiles{P50: 10, P90: 20, P99: 40}},
+		}),
+		"get": summaryOf(map[string]*OpSummary{
+			"get":  {OpsPerSec: 200, Latency: Percentiles{P50: 5, P90: 10, P99: 20}},
+			"head": {OpsPerSec: 300},
+		}),
+		"gone": summaryOf(map[string]*OpSummary{"put": {OpsPerSec: 1}}),
+	}
+
+	current := map[string]*Summary{
+		"put": summaryOf(map[string]*OpSummary{
+			"put": {OpsPerSec: 85, BytesPerSec: 950, Latency: Percentiles{P50: 10.5, P90: 25, P99: 40}},
+		}),
+		"get": summaryOf(map[string]*OpSummary{
+			"get": {OpsPerSec: 250, Latency: Percentiles{P50: 4, P90: 10, P99: 19}},
+		}),
+		"new": summaryOf(map[string]*OpSummary{"put": {OpsPerSec: 1}}),
+	}
+
+	deltas, missing := compareSummaries(baseline, current, 10)
+	if len(missing) != 2 || missing[0] != "get head" || missing[1] != "gone" {
+		t.Errorf("missing %q", missing)
+	}
+
+	regressions := make(map[string]bool)
+	for _, d := range deltas {
+		if d.Regression {
+			regressions[d.Job+" "+d.Operation+" "+d.Metric] = true
+		}
+	}
+
+	// Fewer ops/s and a higher latency regress, bytes/s within the
+	// threshold and a faster get don't.
+	for _, r := range []string{"put put ops/s", "put put p90ms"} {
+		if !regressions[r] {
+			t.Errorf("%s did not regress", r)
+		}
+	}
+
+	if len(regressions) != 2 {
+		t.Errorf("regressions %v", regressions)
+	}
+
+	if len(deltas) != 9 {
+		t.Errorf("%d deltas, the metrics of 0 in the baseline are skipped", len(deltas))
+	}
+}
+
+// Every job of a matrix writes a summary of its own, none are merged.
+func TestLoadSummaries(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"m_1K_1", "m_1K_4"} {
+		raw, _ := json.Marshal(Summary{Bucket: "b", Keyprefix: "p/", Objectsize: "1K", Operations: map[string]*OpSummary{"put": {Ops: 1}}})
+		if err := ioutil.WriteFile(filepath.Join(dir, name+"_summary.json"), raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summaries, err := loadSummaries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(summaries) != 2 || summaries["m_1K_1"] == nil || summaries["m_1K_4"] == nil {
+		t.Errorf("summaries %v", summaries)
+	}
+
+	if _, err := loadSummaries(t.TempDir()); err == nil {
+		t.Errorf("no error for a directory without summaries")
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigError lists every problem found in a config, one per line.
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return "Invalid config:\n\t" + strings.Join(e, "\n\t")
+}
+
+// stripComments blanks // comments outside of strings, so that the commented
+// -skeleton output is a valid config. Offsets stay the same for the errors.
+func stripComments(raw []byte) []byte {
+	out := make([]byte, len(raw))
+	copy(out, raw)
+	inString, escaped, comment := false, false, false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case comment:
+			if c == '\n' {
+				comment = false
+			} else {
+				out[i] = ' '
+			}
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			comment = true
+			out[i] = ' '
+		}
+	}
+
+	return out
+}
+
+func position(raw []byte, offset int64) string {
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+
+	line := bytes.Count(raw[:offset], []byte("\n")) + 1
+	col := offset - int64(bytes.LastIndexByte(raw[:offset], '\n'))
+	return fmt.Sprintf("line %d column %d", line, col)
+}
+
+// parseJobs expands a config, decodes the jobs and validates them. Unknown
+// fields are rejected, so a typo doesn't silently fall back to a default.
+// Jobs are numbered after the expansion of matrices.
+func parseJobs(raw []byte) ([]Job, error) {
+	raw, err := expandConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, ConfigError{"Expected a list of jobs: " + err.Error()}
+	}
+
+	var errs ConfigError
+	jobs := make([]Job, len(items))
+	for j, item := range items {
+		d := json.NewDecoder(bytes.NewReader(item))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&jobs[j]); err != nil {
+			if terr, ok := err.(*json.UnmarshalTypeError); ok {
+				err = fmt.Errorf("%s: expected %v, got %s", terr.Field, terr.Type, terr.Value)
+			}
+
+			errs = append(errs, fmt.Sprintf("job %d: %s", j+1, strings.TrimPrefix(err.Error(), "json: ")))
+			if json.Unmarshal(item, &jobs[j]) != nil {
+				continue
+			}
+		}
+
+		for _, e := range jobs[j].validate() {
+			errs = append(errs, fmt.Sprintf("job %d (%s): %s", j+1, jobs[j].name(), e))
+		}
+	}
+
+	errs = append(errs, uniqueResults(jobs)...)
+	if len(errs) == 0 {
+		errs = append(errs, planStages(jobs)...)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return jobs, nil
+}
+
+// uniqueResults rejects jobs that share their results, their summaries would
+// overwrite each other and compare would only see one of them.
+func uniqueResults(jobs []Job) []string {
+	var errs []string
+	summaries := make(map[string]int)
+	for j := range jobs {
+		path := jobs[j].summaryPath()
+		if path == "" {
+			continue
+		}
+
+		path = filepath.Clean(path)
+		if k, ok := summaries[path]; ok {
+			errs = append(errs, fmt.Sprintf("job %d (%s): results: %q is also written by job %d", j+1, jobs[j].name(), jobs[j].Results, k+1))
+			continue
+		}
+
+		summaries[path] = j
+	}
+
+	return errs
+}
+
+// validate checks the fields of a job and fills in the defaults and parsed
+// values, it returns one message per invalid field.
+func (job *Job) validate() []string {
+	var errs []string
+	fail := func(field string, format string, args ...interface{}) {
+		errs = append(errs, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	// Warnings go to stderr, stdout only carries the results.
+	warn := func(field string, format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s: %s\n", job.name(), field, fmt.Sprintf(format, args...))
+	}
+
+	var err error
+	if job.Bucket == "" {
+		fail("bucket", "missing")
+	}
+
+	if job.Results == "" && !*cleanupMode {
+		fail("results", "missing")
+	}
+
+	for _, n := range []struct {
+		name  string
+		value int64
+	}{
+		{"workers", int64(job.Workers)},
+		{"concurrency", int64(job.Concurrency)},
+		{"count", job.Count},
+		{"existing", job.Existing},
+		{"maxparts", int64(job.Maxparts)},
+		{"depth", int64(job.Depth)},
+		{"fanout", int64(job.Fanout)},
+		{"leaf_objects", int64(job.LeafObjects)},
+		{"cleanup_workers", int64(job.CleanupWorkers)},
+		{"metadata_headers", int64(job.MetadataHeaders)},
+	} {
+		if n.value < 0 {
+			fail(n.name, "%d is negative", n.value)
+		}
+	}
+
+	if job.Workers == 0 {
+		job.Workers = 1
+	}
+
+	if len(job.Mix) > 0 {
+		if job.Operation != "" && job.Operation != "mix" {
+			fail("operation", "%q can't be combined with a mix", job.Operation)
+		}
+
+		job.Operation = "mix"
+		for name := range job.Mix {
+			job.mixOps = append(job.mixOps, name)
+		}
+
+		sort.Strings(job.mixOps)
+		total := 0
+		for _, name := range job.mixOps {
+			if _, ok := operations[name]; !ok {
+				fail("mix", "unknown operation %q, use %s", name, operationNames())
+			}
+
+			if job.Mix[name] < 0 {
+				fail("mix", "negative weight %d for %q", job.Mix[name], name)
+			}
+
+			total += job.Mix[name]
+			job.mixWeights = append(job.mixWeights, total)
+		}
+
+		if total <= 0 {
+			fail("mix", "the weights add up to 0")
+		}
+
+		job.keys = NewKeyspace(job.Existing, job.objectKey, job.Zipf)
+	}
+
+	if job.Operation == "" {
+		job.Operation = "put"
+	}
+
+	if _, ok := operations[job.Operation]; !ok && job.Operation != "mix" {
+		fail("operation", "unknown operation %q, use one of %s", job.Operation, operationNames())
+	}
+
+	for _, d := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"duration", job.Duration, &job.duration},
+		{"warmup", job.Warmup, &job.warmup},
+		{"rampup", job.Rampup, &job.rampup},
+	} {
+		if d.value == "" {
+			continue
+		}
+
+		*d.field, err = time.ParseDuration(d.value)
+		if err != nil || *d.field < 0 {
+			fail(d.name, "%q is not a duration like 90s or 10m", d.value)
+		}
+	}
+
+	job.sizes, err = parseSizes(job.Objectsize)
+	if err != nil {
+		fail("objectsize", "%v", err)
+		job.sizes = fixedSize(0)
+	}
+
+	job.osize = job.sizes.Max()
+
+	if job.RateOps < 0 {
+		fail("rate_ops", "%v is negative", job.RateOps)
+	}
+
+	job.rateBytes, err = unitsToBytes(job.RateBytes)
+	if err != nil {
+		fail("rate_bytes", "%v", err)
+	}
+
+	job.psize, err = unitsToBytes(job.Partsize)
+	if err != nil {
+		fail("partsize", "%v", err)
+	}
+
+	if job.Maxparts > s3manager.MaxUploadParts {
+		fail("maxparts", "%d is more than the %d parts S3 allows", job.Maxparts, s3manager.MaxUploadParts)
+	}
+
+	if job.psize > 0 && job.Maxparts > 0 && job.psize*int64(job.Maxparts) < job.osize {
+		fail("maxparts", "%d parts of partsize %s can't hold objectsize %s", job.Maxparts, job.Partsize, bytesToUnits(job.osize))
+	}
+
+	if job.psize > 0 && job.Maxparts == 0 && (job.osize+job.psize-1)/job.psize > s3manager.MaxUploadParts {
+		fail("partsize", "objectsize %s needs %d parts of %s, at most %d are allowed", bytesToUnits(job.osize), (job.osize+job.psize-1)/job.psize, job.Partsize, s3manager.MaxUploadParts)
+	}
+
+	if job.psize != 0 {
+		pb, _ := unitsToBytes("5M")
+		if job.psize < pb {
+			job.psize, _ = unitsToBytes("5M")
+			warn("partsize", "ignoring %s, the minimum of 5M is used", job.Partsize)
+		}
+	}
+
+	if job.Maxparts > 0 {
+		job.psize = int64(math.Ceil(float64(job.osize) / float64(job.Maxparts)))
+		pb, _ := unitsToBytes("5M")
+		if job.psize < pb {
+			warn("maxparts", "ignoring %d, the parts would be smaller than 5M", job.Maxparts)
+			job.psize = 0
+			job.Maxparts = 0
+		}
+	}
+
+	if job.Compressibility != 0 && job.Compressibility < 1 {
+		fail("compressibility", "%v is less than 1, use 0 or 1 for random data", job.Compressibility)
+	}
+
+	if job.Dedupe < 0 || job.Dedupe >= 1 {
+		fail("dedupe", "%v must be at least 0 and less than 1", job.Dedupe)
+	}
+
+	block := int64(4096)
+	if job.DedupeBlock != "" {
+		block, err = unitsToBytes(job.DedupeBlock)
+		if err != nil {
+			fail("dedupe_block", "%v", err)
+		} else if block < 16 || block > maxBlockSize {
+			fail("dedupe_block", "%s must be between 16B and 1M", job.DedupeBlock)
+		}
+	}
+
+	switch job.KeyStrategy {
+	case "", "sequential", "random", "hashed", "date":
+	default:
+		fail("key_strategy", "unknown strategy %q, use sequential, random, hashed or date", job.KeyStrategy)
+	}
+
+	if job.KeyStrategy != "" && job.KeyStrategy != "sequential" && job.Fanout > 0 {
+		fail("key_strategy", "a fanout names the keys after the tree, remove key_strategy")
+	}
+
+	if job.Zipf != 0 && job.Zipf <= 1 {
+		fail("zipf", "%v must be more than 1, e.g. 1.1 for a mild and 2 for a strong hot spot", job.Zipf)
+	}
+
+	if job.Zipf > 0 && job.Count == 0 && job.From == "" && job.Operation != "mix" {
+		fail("zipf", "needs a count, the hot keys are picked from the first count objects")
+	}
+
+	job.keepVersions = 3
+	if job.Versions != nil {
+		if *job.Versions < 1 {
+			fail("versions", "%d, at least 1 version is kept per key", *job.Versions)
+		}
+
+		job.keepVersions = *job.Versions
+	}
+
+	job.payload = NewPayload(job.Compressibility, job.Dedupe, block)
+	job.validateHeaders(fail)
+
+	if job.AbortPct < 0 || job.IncompletePct < 0 || job.AbortPct+job.IncompletePct > 100 {
+		fail("abort_pct", "abort_pct %v and incomplete_pct %v must be between 0 and 100 together", job.AbortPct, job.IncompletePct)
+	}
+
+	if (job.AbortPct > 0 || job.IncompletePct > 0) && job.Operation != "multipart" && job.Mix["multipart"] == 0 {
+		fail("abort_pct", "only multipart uploads can be aborted or left incomplete")
+	}
+
+	if job.Fanout > 0 {
+		if job.Depth == 0 {
+			job.Depth = 1
+		}
+
+		if job.LeafObjects == 0 {
+			job.LeafObjects = 1
+		}
+
+		if job.treeSize() < 0 {
+			fail("fanout", "a tree of depth %d and fanout %d is too large", job.Depth, job.Fanout)
+		} else if job.Count == 0 && job.duration == 0 {
+			job.Count = job.treeSize()
+		}
+	} else if job.Depth > 0 || job.LeafObjects > 0 {
+		fail("fanout", "depth and leaf_objects need a fanout")
+	}
+
+	if job.PageSize < 0 || job.PageSize > 1000 {
+		fail("pagesize", "%d must be between 0 (default) and 1000", job.PageSize)
+	}
+
+	if job.Operation == "multipart" || job.Mix["multipart"] > 0 {
+		if job.psize == 0 {
+			job.psize = s3manager.MinUploadPartSize
+		}
+
+		if parts := (job.osize + job.psize - 1) / job.psize; parts > s3manager.MaxUploadParts {
+			fail("objectsize", "%s needs %d parts of %s, at most %d are allowed", job.Objectsize, parts, bytesToUnits(job.psize), s3manager.MaxUploadParts)
+		}
+	}
+
+	if (job.Cleanup || *cleanupMode) && job.Keyprefix == "" {
+		fail("keyprefix", "cleanup needs a keyprefix, it would delete every object of the bucket")
+	}
+
+	if job.Count == 0 && job.duration == 0 && job.From == "" && !*cleanupMode {
+		fail("count", "the job needs a count or a duration")
+	}
+
+	return errs
+}
+
+func operationNames() string {
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+const skeletonConfig = `// objectbench config, a list of jobs that run in parallel. Comments like this
+// one are allowed. Sizes take a unit of B, K, M, G or T, durations look like
+// 90s or 10m.
+[
+    {
+        // put, get, head, delete, list, listwalk, listdir, verify, multipart
+        // or versions.
+        "operation": "put",
+        "bucket": "bucket1",
+        // Objects are named <keyprefix><n>.
+        "keyprefix": "test11/node1/",
+        // A size, uniform:4K-1M, lognormal:mean=64K,sigma=1.5,max=1G or a
+        // weighted list like 4K:50,1M:40,100M:10.
+        "objectsize": "10M",
+        // Parts uploaded or downloaded in parallel per object.
+        "concurrency": 3,
+        // Part size of multipart uploads, at least 5M.
+        "partsize": "5M",
+        // Split every object into this many parts instead, at most 10000.
+        "maxparts": 0,
+        // Leave the parts of failed uploads behind.
+        "delparts": false,
+        // Parallel requests.
+        "workers": 100,
+        // Failed requests are appended as json lines.
+        "errorlog": "bucket1_test11_err.log",
+        // Every request is appended as a csv line, the summary is written to
+        // <results>_summary.json. Required, and unique per job.
+        "results": "bucket1_test11_results.csv",
+        // Number of objects, with a duration the keys are reused.
+        "count": 100000,
+        // Run for this long instead of count requests.
+        "duration": "",
+        // Results of the warmup are not counted.
+        "warmup": "",
+        // Start the workers evenly over this time.
+        "rampup": "",
+        // Weights of operations run against the same keys, e.g.
+        // {"put": 20, "get": 70, "delete": 10}. Replaces the operation.
+        "mix": {},
+        // Keys <keyprefix>1 to <keyprefix><existing> a mix can read right away.
+        "existing": 0,
+        // Seed of the payloads, verify checks the payload of the same seed.
+        "seed": 0,
+        // Store the seed and a crc64 of the payload as metadata.
+        "checksum": false,
+        // Open loop rates, requests are started on schedule even if the
+        // store falls behind. 0 runs closed loop.
+        "rate_ops": 0,
+        "rate_bytes": "",
+        // Label of the results, defaults to the endpoint if one is set.
+        "target": "",
+        // Override the command line flags for this job.
+        "region": "",
+        "endpoint": "",
+        "profile": "",
+        "accesskey": "",
+        "secretkey": "",
+        "anonymous": false,
+        "pathstyle": null,
+        "nossl": null,
+        "nomd5": null,
+        "nosum": null,
+        "retries": null,
+        // Percent of multipart uploads aborted or left incomplete.
+        "abort_pct": 0,
+        "incomplete_pct": 0,
+        // Keys form a tree of depth levels of fanout directories with
+        // leaf_objects objects each, 0 uses <keyprefix><n>.
+        "depth": 0,
+        "fanout": 0,
+        "leaf_objects": 0,
+        // Keys per page of listwalk and listdir, 0 uses the default of 1000.
+        "pagesize": 0,
+        // Delete everything below the keyprefix after the job.
+        "cleanup": false,
+        "cleanup_workers": 8,
+        // Label of the job, after and from refer to it.
+        "name": "",
+        // Jobs of a stage run in parallel, stages one after the other.
+        "stage": 0,
+        // Run in a stage after the job of this name.
+        "after": "",
+        // Run after the job of this name on the objects it wrote, count
+        // defaults to their number.
+        "from": "",
+        // Payloads compress by about this ratio, 0 or 1 is random data.
+        "compressibility": 0,
+        // Fraction of the dedupe_block sized blocks of an object that repeat
+        // an earlier block of it.
+        "dedupe": 0,
+        "dedupe_block": "4K",
+        // sse-s3, sse-kms or sse-c with a key generated per object.
+        "encryption": "",
+        "kms_key_id": "",
+        "storage_class": "",
+        // A canned acl like private or bucket-owner-full-control.
+        "acl": "",
+        "content_type": "",
+        "tagging": "",
+        // Send this many user metadata headers of metadata_size each.
+        "metadata_headers": 0,
+        "metadata_size": "16B",
+        // sequential <keyprefix>42, random <keyprefix>a5e1f2c4b7d90e13,
+        // hashed <keyprefix>9c1e/42 or date <keyprefix>2020/01/01/00/42.
+        "key_strategy": "sequential",
+        // Pick the keys of reads and overwrites from a zipf distribution
+        // with this exponent, more than 1, instead of one after the other.
+        "zipf": 0,
+        // The versions operation writes this many versions of every key,
+        // then every round reads the latest and an older version, lists the
+        // versions, writes a new one and deletes the oldest.
+        "versions": 3,
+        // Enable versioning on the bucket before the job.
+        "versioning": false
+    }
+]
+`
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// expectConfigError parses the config and looks for the message in its errors.
+func expectConfigError(t *testing.T, config string, message string) {
+	t.Helper()
+	_, err := parseJobs([]byte(config))
+	if err == nil || !strings.Contains(err.Error(), message) {
+		t.Errorf("%s: got %v, expected %q", config, err, message)
+	}
+}
+
+// Jobs that share their results would overwrite each other's summary.
+func TestUniqueResults(t *testing.T) {
+	expectConfigError(t, `[{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "results": "r.csv"},
+		{"bucket": "b", "objectsize": "1K", "operation": "get", "count": 1, "results": "./r.csv"}]`,
+		`job 2 (b/): results: "./r.csv" is also written by job 1`)
+	expectConfigError(t, `[{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "results": "r.csv"},
+		{"bucket": "b", "objectsize": "1K", "operation": "get", "count": 1, "results": "r.json"}]`,
+		`job 2 (b/): results: "r.json" is also written by job 1`)
+
+	if _, err := parseJobs([]byte(`[{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "results": "r1.csv"},
+		{"bucket": "b", "objectsize": "1K", "operation": "get", "count": 1, "results": "r2.csv"}]`)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		job     string
+		message string
+	}{
+		{`{"objectsize": "1K", "operation": "put", "count": 1, "results": "r.csv"}`, "job 1 (/): bucket: missing"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1}`, "job 1 (b/): results: missing"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "results": "r.csv"}`, "count: the job needs a count or a duration"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "copy", "count": 1, "results": "r.csv"}`, `operation: unknown operation "copy"`},
+		{`{"bucket": "b", "objectsize": "1X", "operation": "put", "count": 1, "results": "r.csv"}`, "objectsize:"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "workers": -1, "results": "r.csv"}`, "workers:"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "warmup": "soon", "results": "r.csv"}`, `warmup: "soon" is not a duration`},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "rate_ops": -1, "results": "r.csv"}`, "rate_ops: -1 is negative"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "abort_pct": 10, "results": "r.csv"}`, "abort_pct: only multipart uploads"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "cleanup": true, "results": "r.csv"}`, "keyprefix: cleanup needs a keyprefix"},
+		{`{"bucket": "b", "objectsize": "1K", "mix": {"put": 1, "copy": 1}, "count": 1, "results": "r.csv"}`, `mix: unknown operation "copy"`},
+		{`{"bucket": "b", "objectsize": "1K", "mix": {"put": 0}, "count": 1, "results": "r.csv"}`, "mix: the weights add up to 0"},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "result": "r.csv"}`, `unknown field "result"`},
+		{`{"bucket": "b", "objectsize": "1K", "operation": "put", "count": "1", "results": "r.csv"}`, "count: expected int64, got string"},
+	} {
+		expectConfigError(t, "["+c.job+"]", c.message)
+	}
+}
+
+// Every problem of a config is reported at once.
+func TestValidateAllErrors(t *testing.T) {
+	_, err := parseJobs([]byte(`[{"objectsize": "1K", "operation": "put", "count": 1}, {"bucket": "b", "operation": "copy", "count": 1, "results": "r.csv"}]`))
+	errs, ok := err.(ConfigError)
+	if !ok || len(errs) != 3 {
+		t.Errorf("got %v, expected 3 errors", err)
+	}
+}
+
+// The skeleton is a valid config.
+func TestSkeletonConfig(t *testing.T) {
+	jobs, err := parseJobs([]byte(skeletonConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) == 0 || jobs[0].Results == "" {
+		t.Errorf("jobs %+v", jobs)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var listen = flag.String("listen", ":18089", "Address the controller listens on for results published by the services")
+var merged = flag.String("merged", "controller_results.csv", "The controller writes the results of all services to this csv file")
+
+type Collector struct {
+	w  *csv.Writer
+	mu sync.Mutex
+}
+
+var collector *Collector
+
+// Batch is what a service publishes to the controller, Dropped counts all
+// results the service dropped so far.
+type Batch struct {
+	Node    string
+	Results []Result
+	Dropped int64
+}
+
+func (c *Collector) add(b *Batch) {
+	for i := range b.Results {
+		r := &b.Results[i]
+		if r.Err == "ok" {
+			overall.count(r.Operation, r.Bytes)
+		} else {
+			overall.fail(r.Operation)
+		}
+
+		overall.countNode(b.Node, r.Bytes, r.Err == "ok")
+	}
+
+	overall.drop(b.Node, b.Dropped)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range b.Results {
+		if err := c.w.Write(b.Results[i].ResultArray()); err != nil {
+			fmt.Printf("Error writing %s: %v\n", *merged, err)
+		}
+	}
+
+	c.w.Flush()
+}
+
+func (ov *Overview) countNode(node string, bytes int64, ok bool) {
+	ov.mu.Lock()
+	c, found := ov.Nodes[node]
+	if !found {
+		c = &OpCounter{}
+		ov.Nodes[node] = c
+	}
+
+	if ok {
+		c.Ops++
+		c.Bytes += bytes
+	} else {
+		c.Errors++
+	}
+	ov.mu.Unlock()
+}
+
+func (ov *Overview) drop(node string, dropped int64) {
+	ov.mu.Lock()
+	if n, ok := ov.Dropped[node]; !ok || dropped > n {
+		ov.Dropped[node] = dropped
+	}
+	ov.mu.Unlock()
+}
+
+// runController hands the jobs to every service listed in -controller. The
+// services run them and publish each result back to the controller, which
+// reports the totals per second and merges all results into one csv file.
+// runController sends the expanded config, so the services don't need the
+// environment variables of the controller.
+func runController(rawjson []byte) {
+	if _, err := parseJobs(rawjson); err != nil {
+		exitErrorf("%v", err)
+	}
+
+	rawjson, err := expandConfig(rawjson)
+	if err != nil {
+		exitErrorf("%v", err)
+	}
+
+	f, err := os.OpenFile(*merged, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		exitErrorf("Error writing %s: %v", *merged, err)
+	}
+	defer f.Close()
+
+	overall.reset()
+	collector = &Collector{w: csv.NewWriter(f)}
+	netService := new(ObjectBenchService)
+	rpc.Register(netService)
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		exitErrorf("RPC Error %v\n", err)
+	}
+
+	go rpc.Accept(listener)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	var hosts []string
+	var calls []*rpc.Call
+	for _, host := range strings.Split(*controllerOf, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "18088")
+		}
+
+		conn, err := net.Dial("tcp", host)
+		if err != nil {
+			exitErrorf("Unable to reach service %s %v", host, err)
+		}
+
+		// The services publish to the address they were reached from.
+		client := rpc.NewClient(conn)
+		defer client.Close()
+		callback := net.JoinHostPort(conn.LocalAddr().(*net.TCPAddr).IP.String(), port)
+		args := &Args{WorkRequest: string(rawjson), Controller: callback, Node: host}
+		hosts = append(hosts, host)
+		calls = append(calls, client.Go("ObjectBenchService.Emit", args, new(int), nil))
+		fmt.Println("Started jobs on", host)
+	}
+
+	var cchan = make(chan bool)
+	rwg.Add(1)
+	go reportOverview(cchan)
+
+	for i, call := range calls {
+		<-call.Done
+		if call.Error != nil {
+			fmt.Printf("Service %s failed: %v\n", hosts[i], call.Error)
+		}
+	}
+
+	cchan <- true
+	rwg.Wait()
+	overall.printOperations()
+}
+
+var pchan chan Result
+var pwg sync.WaitGroup
+var dropped int64
+
+const publishBatch = 512
+
+// startPublisher sends the results to the controller in batches of up to
+// publishBatch results, or what arrived within 100ms. The last batch is sent
+// even when empty, it carries the final count of dropped results.
+func startPublisher(client *rpc.Client, node string) {
+	pchan = make(chan Result, 16*publishBatch)
+	atomic.StoreInt64(&dropped, 0)
+	pwg.Add(1)
+	go func() {
+		defer pwg.Done()
+		batch := &Batch{Node: node, Results: make([]Result, 0, publishBatch)}
+		send := func() {
+			batch.Dropped = atomic.LoadInt64(&dropped)
+			var reply int
+			if err := client.Call("ObjectBenchService.Publish", batch, &reply); err != nil {
+				fmt.Printf("Error publishing %d results %v\n", len(batch.Results), err)
+			}
+
+			batch.Results = batch.Results[:0]
+		}
+
+		flush := func() {
+			if len(batch.Results) > 0 {
+				send()
+			}
+		}
+
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case r, ok := <-pchan:
+				if !ok {
+					send()
+					return
+				}
+
+				r.Node = node
+				batch.Results = append(batch.Results, r)
+				if len(batch.Results) == publishBatch {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+func stopPublisher() {
+	close(pchan)
+	pwg.Wait()
+	pchan = nil
+	if n := atomic.LoadInt64(&dropped); n > 0 {
+		fmt.Printf("Dropped %d results the controller did not take in time\n", n)
+	}
+}
+
+// publish never blocks the workers, a result that doesn't fit in the queue
+// is dropped and counted instead.
+func publish(r Result) {
+	if pchan == nil {
+		return
+	}
+
+	select {
+	case pchan <- r:
+	default:
+		atomic.AddInt64(&dropped, 1)
+	}
+}
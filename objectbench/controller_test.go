@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync/atomic"
+	"testing"
+)
+
+// The results of a service reach the controller in batches, with the count
+// of the results the service dropped.
+func TestPublish(t *testing.T) {
+	var out bytes.Buffer
+	overall.reset()
+	collector = &Collector{w: csv.NewWriter(&out)}
+	defer func() { collector = nil }()
+
+	server := rpc.NewServer()
+	server.Register(new(ObjectBenchService))
+	conn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	startPublisher(client, "node1")
+	for i := 0; i < 3*publishBatch+10; i++ {
+		publish(Result{Err: "ok", Operation: "put", Object: fmt.Sprint(i), Bytes: 1})
+	}
+
+	atomic.StoreInt64(&dropped, 5)
+	stopPublisher()
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3*publishBatch+10 {
+		t.Errorf("merged %d results", len(records))
+	}
+
+	if c := overall.Nodes["node1"]; c == nil || c.Ops != 3*publishBatch+10 || c.Bytes != 3*publishBatch+10 {
+		t.Errorf("node1 counted %+v", c)
+	}
+
+	if overall.Dropped["node1"] != 5 {
+		t.Errorf("node1 dropped %d results, expected 5", overall.Dropped["node1"])
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"net"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+)
+
+var errVerify = errors.New("verify mismatch")
+var errVersion = errors.New("version mismatch")
+
+// classifyError reduces an error to a class for the summaries: the S3 error
+// code such as SlowDown, InternalError or NoSuchBucket if the store sent one,
+// HTTP<status> if it only sent a status, or the kind of network failure.
+func classifyError(err error) (class string, status int, requestId string) {
+	for err != nil {
+		if err == errVerify {
+			return "VerifyMismatch", 0, ""
+		}
+
+		if err == errVersion {
+			return "VersionMismatch", 0, ""
+		}
+
+		if rf, ok := err.(awserr.RequestFailure); ok {
+			status, requestId = rf.StatusCode(), rf.RequestID()
+			if rf.Code() != "" {
+				return rf.Code(), status, requestId
+			}
+
+			return fmt.Sprintf("HTTP%d", status), status, requestId
+		}
+
+		if ae, ok := err.(awserr.Error); ok {
+			if ae.Code() == "RequestCanceled" {
+				return "Canceled", 0, ""
+			}
+
+			if ae.OrigErr() == nil {
+				return ae.Code(), 0, ""
+			}
+
+			err = ae.OrigErr()
+			continue
+		}
+
+		break
+	}
+
+	var nerr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNRESET):
+		return "ConnectionReset", 0, ""
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "ConnectionRefused", 0, ""
+	case errors.As(err, &nerr) && nerr.Timeout():
+		return "Timeout", 0, ""
+	}
+
+	return "Other", 0, ""
+}
+
+func (job *Job) failed(op string, filename string, t time.Time, err error, msg string) Result {
+	class, status, requestId := classifyError(err)
+	return Result{
+		Err:       msg,
+		Bucket:    job.Bucket,
+		Object:    filename,
+		StartTime: t.UnixNano(),
+		EndTime:   time.Now().UnixNano(),
+		Operation: op,
+		ErrClass:  class,
+		Status:    status,
+		RequestId: requestId,
+	}
+}
+
+// aborted is the result of an operation made of several requests when one of
+// them failed. Only the failed request, a part of the result, carries the
+// error class, so every failure is counted and logged once.
+func (job *Job) aborted(op string, filename string, t time.Time, cause Result) Result {
+	return Result{
+		Err:       cause.Err,
+		Bucket:    job.Bucket,
+		Object:    filename,
+		StartTime: t.UnixNano(),
+		EndTime:   time.Now().UnixNano(),
+		Operation: op,
+	}
+}
+
+type Failure struct {
+	Time      string `json:"time"`
+	Bucket    string `json:"bucket"`
+	Object    string `json:"object"`
+	Operation string `json:"operation"`
+	Class     string `json:"class"`
+	Status    int    `json:"status,omitempty"`
+	RequestId string `json:"requestid,omitempty"`
+	Message   string `json:"message"`
+}
+
+// logFailure appends one json line per failed request to the job's Errorlog.
+func (job *Job) logFailure(r Result) {
+	job.logMu.Lock()
+	defer job.logMu.Unlock()
+	if job.Errorlog == "" {
+		return
+	}
+
+	if job.errlog == nil {
+		f, err := os.OpenFile(job.Errorlog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Printf("Error writing %s: %v\n", job.Errorlog, err)
+			job.Errorlog = ""
+			return
+		}
+
+		job.errlog = f
+	}
+
+	raw, _ := json.Marshal(Failure{
+		Time:      time.Unix(0, r.EndTime).Format(time.RFC3339Nano),
+		Bucket:    r.Bucket,
+		Object:    r.Object,
+		Operation: r.Operation,
+		Class:     r.ErrClass,
+		Status:    r.Status,
+		RequestId: r.RequestId,
+		Message:   r.Err,
+	})
+	if _, err := job.errlog.Write(append(raw, '\n')); err != nil {
+		fmt.Printf("Error writing %s: %v\n", job.Errorlog, err)
+	}
+}
+
+func (job *Job) closeErrorlog() {
+	job.logMu.Lock()
+	defer job.logMu.Unlock()
+	if job.errlog != nil {
+		job.errlog.Close()
+		job.errlog = nil
+	}
+}
+
+func printErrorClasses(name string, classes map[string]int64) {
+	if len(classes) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(classes))
+	for class := range classes {
+		names = append(names, class)
+	}
+
+	sort.Strings(names)
+	fmt.Println("job,errorclass,count")
+	for _, class := range names {
+		fmt.Printf("%s,%s,%d\n", name, class, classes[class])
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	for _, c := range []struct {
+		err       error
+		class     string
+		status    int
+		requestId string
+	}{
+		{awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "r1"), "SlowDown", 503, "r1"},
+		{awserr.NewRequestFailure(awserr.New("", "", nil), 502, "r2"), "HTTP502", 502, "r2"},
+		{awserr.New("RequestCanceled", "request context canceled", nil), "Canceled", 0, ""},
+		{awserr.New("SerializationError", "failed to decode", nil), "SerializationError", 0, ""},
+		{awserr.New("RequestError", "send request failed", refused), "ConnectionRefused", 0, ""},
+		{awserr.New("RequestError", "send request failed", reset), "ConnectionReset", 0, ""},
+		{awserr.New("RequestError", "send request failed", &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}), "Timeout", 0, ""},
+		{errVerify, "VerifyMismatch", 0, ""},
+		{errVersion, "VersionMismatch", 0, ""},
+		{errors.New("something else"), "Other", 0, ""},
+		{fmt.Errorf("wrapped %w", refused), "ConnectionRefused", 0, ""},
+	} {
+		class, status, requestId := classifyError(c.err)
+		if class != c.class || status != c.status || requestId != c.requestId {
+			t.Errorf("%v: got %s %d %q, expected %s %d %q", c.err, class, status, requestId, c.class, c.status, c.requestId)
+		}
+	}
+}
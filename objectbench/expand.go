@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var variable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandConfig turns a json or yaml config into the json list of jobs to run.
+//
+// ${VAR} is replaced by the environment variable VAR. A list as the value of a
+// field makes a matrix, the job is repeated for every combination of the
+// values of its lists:
+//
+//   - bucket: bucket1
+//     objectsize: [4K, 1M, 100M]
+//     workers: [1, 16, 64]
+//     results: results_${objectsize}_${workers}.csv
+//
+// runs 9 jobs. ${field} in a string refers to the value of a field of the
+// expanded job, which keeps the results of the jobs apart.
+func expandConfig(raw []byte) ([]byte, error) {
+	var items []map[string]interface{}
+	trimmed := bytes.TrimSpace(raw)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("//")) {
+		raw = stripComments(raw)
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		if err := d.Decode(&items); err != nil {
+			if serr, ok := err.(*json.SyntaxError); ok {
+				return nil, ConfigError{fmt.Sprintf("%s: %v", position(raw, serr.Offset), err)}
+			}
+
+			return nil, ConfigError{"Expected a list of jobs: " + err.Error()}
+		}
+	} else if err := yaml.Unmarshal(raw, &items); err != nil {
+		return nil, ConfigError{err.Error()}
+	}
+
+	var jobs []map[string]interface{}
+	var errs ConfigError
+	for i, item := range items {
+		for key, value := range item {
+			if list, ok := value.([]interface{}); ok && len(list) == 0 {
+				errs = append(errs, fmt.Sprintf("job %d: %s: the list is empty, the matrix would have no jobs", i+1, key))
+			}
+
+			item[key] = expandEnv(key, value)
+		}
+
+		jobs = append(jobs, expandMatrix(item)...)
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, errs
+	}
+
+	for j, job := range jobs {
+		for key, value := range job {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+
+			job[key] = variable.ReplaceAllStringFunc(s, func(m string) string {
+				name := m[2 : len(m)-1]
+				if v, ok := job[name]; ok {
+					if _, list := v.([]interface{}); !list {
+						return fmt.Sprint(v)
+					}
+				}
+
+				errs = append(errs, fmt.Sprintf("job %d: %s: ${%s} is neither an environment variable nor a field", j+1, key, name))
+				return m
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, errs
+	}
+
+	if jobs == nil {
+		jobs = []map[string]interface{}{}
+	}
+
+	return json.Marshal(jobs)
+}
+
+// expandEnv replaces ${VAR} by the environment variable VAR in the string
+// values of a field, also in the lists of a matrix. The config is parsed
+// first, so a variable never changes its structure. A value that is only a
+// variable, like workers: ${WORKERS}, takes the type of a number or boolean
+// field.
+func expandEnv(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = expandEnv(key, v[i])
+		}
+	case string:
+		if m := variable.FindStringSubmatch(v); m != nil && m[0] == v {
+			if env, ok := os.LookupEnv(m[1]); ok {
+				return scalar(key, env)
+			}
+		}
+
+		return variable.ReplaceAllStringFunc(v, func(m string) string {
+			if env, ok := os.LookupEnv(m[2 : len(m)-1]); ok {
+				return env
+			}
+
+			return m
+		})
+	}
+
+	return value
+}
+
+// jobKinds are the kinds of the fields of a job by their name in the config.
+var jobKinds = func() map[string]reflect.Kind {
+	kinds := make(map[string]reflect.Kind)
+	t := reflect.TypeOf(Job{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		kinds[name] = ft.Kind()
+	}
+
+	return kinds
+}()
+
+func scalar(key string, s string) interface{} {
+	kind, ok := jobKinds[key]
+	if !ok || kind == reflect.String {
+		return s
+	}
+
+	var v interface{}
+	if yaml.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+
+	switch v.(type) {
+	case int, float64, bool:
+		return v
+	}
+
+	return s
+}
+
+// expandMatrix returns a job for every combination of the values of the
+// fields that are lists.
+func expandMatrix(job map[string]interface{}) []map[string]interface{} {
+	var axes []string
+	for key, value := range job {
+		if _, ok := value.([]interface{}); ok {
+			axes = append(axes, key)
+		}
+	}
+
+	sort.Strings(axes)
+	jobs := []map[string]interface{}{{}}
+	for key, value := range job {
+		if _, ok := value.([]interface{}); !ok {
+			jobs[0][key] = value
+		}
+	}
+
+	for _, axis := range axes {
+		values := job[axis].([]interface{})
+		var next []map[string]interface{}
+		for _, j := range jobs {
+			for _, v := range values {
+				c := make(map[string]interface{}, len(j)+1)
+				for key, value := range j {
+					c[key] = value
+				}
+
+				c[axis] = v
+				next = append(next, c)
+			}
+		}
+
+		jobs = next
+	}
+
+	return jobs
+}
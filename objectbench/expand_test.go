@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func expand(t *testing.T, config string) []map[string]interface{} {
+	t.Helper()
+	raw, err := expandConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jobs []map[string]interface{}
+	if err := json.Unmarshal(raw, &jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	return jobs
+}
+
+func TestExpandMatrix(t *testing.T) {
+	jobs := expand(t, `
+- bucket: b
+  objectsize: [4K, 1M]
+  workers: [1, 16, 64]
+  operation: put
+  count: 10
+  results: m_${objectsize}_${workers}.csv
+`)
+
+	if len(jobs) != 6 {
+		t.Fatalf("%d jobs", len(jobs))
+	}
+
+	results := make(map[string]bool)
+	for _, job := range jobs {
+		results[job["results"].(string)] = true
+		if job["bucket"] != "b" || job["count"] != 10.0 {
+			t.Errorf("job %v", job)
+		}
+	}
+
+	for _, r := range []string{"m_4K_1.csv", "m_4K_16.csv", "m_4K_64.csv", "m_1M_1.csv", "m_1M_16.csv", "m_1M_64.csv"} {
+		if !results[r] {
+			t.Errorf("no job writes %s, %v", r, results)
+		}
+	}
+
+	// The json configs expand the same way, comments included.
+	jobs = expand(t, `// a matrix
+[{"bucket": "b", "objectsize": ["4K", "1M"], "results": "j_${objectsize}.csv"}]`)
+	if len(jobs) != 2 || jobs[1]["results"] != "j_1M.csv" {
+		t.Errorf("jobs %v", jobs)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("OB_BUCKET", "b007")
+	os.Setenv("OB_WORKERS", "8")
+	os.Setenv("OB_QUOTE", `a"b`)
+	defer os.Unsetenv("OB_BUCKET")
+	defer os.Unsetenv("OB_WORKERS")
+	defer os.Unsetenv("OB_QUOTE")
+	jobs := expand(t, `[{"bucket": "${OB_BUCKET}", "workers": "${OB_WORKERS}", "keyprefix": "${OB_QUOTE}/", "objectsize": ["${OB_WORKERS}K"], "results": "${OB_BUCKET}_${workers}.csv"}]`)
+	job := jobs[0]
+	if job["bucket"] != "b007" || job["workers"] != 8.0 || job["keyprefix"] != `a"b/` || job["objectsize"] != "8K" || job["results"] != "b007_8.csv" {
+		t.Errorf("job %v", job)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	for _, c := range []struct {
+		config  string
+		message string
+	}{
+		{`[{"bucket": "b", "objectsize": [], "results": "r.csv"}]`, "job 1: objectsize: the list is empty"},
+		{"- bucket: b\n  workers: []\n", "job 1: workers: the list is empty"},
+		{`[{"bucket": "b", "results": "${OB_UNSET}.csv"}]`, "job 1: results: ${OB_UNSET} is neither an environment variable nor a field"},
+		{`[{"bucket": "b",}]`, "line 1"},
+		{"- bucket: [b\n", "yaml"},
+	} {
+		_, err := expandConfig([]byte(c.config))
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("%s: got %v, expected %q", c.config, err, c.message)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// validateHeaders checks the encryption, storage class, acl, tagging and
+// metadata fields of a job and builds its user metadata.
+func (job *Job) validateHeaders(fail func(field string, format string, args ...interface{})) {
+	switch job.Encryption {
+	case "", "sse-s3", "sse-kms":
+	case "sse-c":
+		insecure := *nossl
+		if job.Nossl != nil {
+			insecure = *job.Nossl
+		}
+
+		if insecure {
+			fail("encryption", "sse-c keys are only sent over https, remove nossl")
+		}
+	default:
+		fail("encryption", "unknown encryption %q, use sse-s3, sse-kms or sse-c", job.Encryption)
+	}
+
+	if job.KmsKeyId != "" && job.Encryption != "sse-kms" {
+		fail("kms_key_id", "only used with sse-kms encryption")
+	}
+
+	if job.ACL != "" && !contains(s3.ObjectCannedACL_Values(), job.ACL) {
+		fail("acl", "unknown canned acl %q, use one of %s", job.ACL, strings.Join(s3.ObjectCannedACL_Values(), ", "))
+	}
+
+	if _, err := url.ParseQuery(job.Tagging); err != nil {
+		fail("tagging", "%q is not like key1=value1&key2=value2, %v", job.Tagging, err)
+	}
+
+	size, err := unitsToBytes(job.MetadataSize)
+	if err != nil {
+		fail("metadata_size", "%v", err)
+	}
+
+	if job.MetadataHeaders > 0 {
+		if size == 0 {
+			size = 16
+		}
+
+		job.userMetadata = make(map[string]*string, job.MetadataHeaders)
+		value := strings.Repeat("m", int(size))
+		for i := 1; i <= job.MetadataHeaders; i++ {
+			job.userMetadata["objectbench-meta-"+strconv.Itoa(i)] = aws.String(value)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return aws.String(s)
+}
+
+// metadata adds the user metadata of the job to the given metadata.
+func (job *Job) metadata(metadata map[string]*string) map[string]*string {
+	if metadata == nil {
+		return job.userMetadata
+	}
+
+	for k, v := range job.userMetadata {
+		metadata[k] = v
+	}
+
+	return metadata
+}
+
+func (job *Job) serverSideEncryption() *string {
+	switch job.Encryption {
+	case "sse-s3":
+		return aws.String(s3.ServerSideEncryptionAes256)
+	case "sse-kms":
+		return aws.String(s3.ServerSideEncryptionAwsKms)
+	}
+
+	return nil
+}
+
+// customerKey returns the sse-c algorithm and key of an object. The key is
+// generated from the seed, the bucket and the key of the object, so every
+// request on the object can send it again.
+func (job *Job) customerKey(filename string) (algorithm *string, key *string) {
+	if job.Encryption != "sse-c" {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d/%s/%s", job.Seed, job.Bucket, filename)))
+	return aws.String(s3.ServerSideEncryptionAes256), aws.String(string(sum[:]))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateHeaders(t *testing.T) {
+	for _, c := range []struct {
+		fields  string
+		message string
+	}{
+		{`"encryption": "aes"`, `encryption: unknown encryption "aes"`},
+		{`"encryption": "sse-c", "nossl": true`, "encryption: sse-c keys are only sent over https"},
+		{`"kms_key_id": "k1"`, "kms_key_id: only used with sse-kms encryption"},
+		{`"acl": "everyone"`, `acl: unknown canned acl "everyone"`},
+		{`"tagging": "a=%zz"`, "tagging:"},
+		{`"metadata_size": "1X"`, "metadata_size:"},
+	} {
+		expectConfigError(t, `[{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "results": "r.csv", `+c.fields+`}]`, c.message)
+	}
+
+	jobs, err := parseJobs([]byte(`[{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "results": "r.csv", "encryption": "sse-kms", "kms_key_id": "k1", "acl": "private", "tagging": "a=1&b=2", "metadata_headers": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs[0].userMetadata) != 2 || aws.StringValue(jobs[0].userMetadata["objectbench-meta-2"]) != "mmmmmmmmmmmmmmmm" {
+		t.Errorf("metadata %v", jobs[0].userMetadata)
+	}
+
+	if aws.StringValue(jobs[0].serverSideEncryption()) != s3.ServerSideEncryptionAwsKms {
+		t.Errorf("server side encryption %v", jobs[0].serverSideEncryption())
+	}
+}
+
+// Every request on an object sends the same sse-c key, the keys of two
+// objects differ.
+func TestCustomerKey(t *testing.T) {
+	job := &Job{Bucket: "b", Encryption: "sse-c", Seed: 7}
+	algorithm, key := job.customerKey("k1")
+	_, again := job.customerKey("k1")
+	_, other := job.customerKey("k2")
+	if aws.StringValue(algorithm) != "AES256" || len(aws.StringValue(key)) != 32 {
+		t.Errorf("algorithm %v, %d byte key", aws.StringValue(algorithm), len(aws.StringValue(key)))
+	}
+
+	if aws.StringValue(key) != aws.StringValue(again) || aws.StringValue(key) == aws.StringValue(other) {
+		t.Errorf("the keys of k1 differ or equal the key of k2")
+	}
+
+	job.Encryption = "sse-s3"
+	if algorithm, key := job.customerKey("k1"); algorithm != nil || key != nil {
+		t.Errorf("sse-c key for sse-s3")
+	}
+}
+
+// The user metadata of a job is stored with its objects.
+func TestMetadataHeaders(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(0, 0))
+	defer server.Close()
+	put := on(server, map[string]interface{}{"bucket": "it", "keyprefix": "headers/", "objectsize": "1K", "workers": 1, "operation": "put", "count": 2, "metadata_headers": 3, "metadata_size": "8", "storage_class": "STANDARD_IA", "content_type": "text/plain", "results": "put"})
+	runTestJobs(t, put)
+
+	raw, _ := json.Marshal([]map[string]interface{}{put})
+	jobs, err := parseJobs(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := jobs[0].session(make(map[string]*session.Session))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := s3.New(sess).HeadObject(&s3.HeadObjectInput{Bucket: aws.String("it"), Key: aws.String("headers/1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Metadata) != 3 || aws.StringValue(out.Metadata["Objectbench-Meta-3"]) != "mmmmmmmm" {
+		t.Errorf("metadata %v", out.Metadata)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Histogram counts values in log-linear buckets like an HDR histogram. Every
+// power of two is split into 128 linear sub buckets, which keeps the error of
+// a reported value below 1%.
+type Histogram struct {
+	counts []int64
+	count  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+const histSubBits = 8
+const histSub = 1 << histSubBits
+
+func NewHistogram() *Histogram {
+	return &Histogram{min: math.MaxInt64}
+}
+
+func histIndex(v int64) int {
+	if v < histSub {
+		return int(v)
+	}
+
+	e := bits.Len64(uint64(v)) - histSubBits
+	return histSub + (e-1)*(histSub/2) + int(v>>uint(e)) - histSub/2
+}
+
+// histValue returns the highest value that is counted in bucket i.
+func histValue(i int) int64 {
+	if i < histSub {
+		return int64(i)
+	}
+
+	e := (i-histSub)/(histSub/2) + 1
+	sub := int64((i-histSub)%(histSub/2) + histSub/2)
+	return (sub+1)<<uint(e) - 1
+}
+
+func (h *Histogram) Record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+
+	i := histIndex(v)
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	if v < h.min {
+		h.min = v
+	}
+
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *Histogram) Merge(o *Histogram) {
+	if len(o.counts) > len(h.counts) {
+		counts := make([]int64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+
+	h.count += o.count
+	h.sum += o.sum
+	if o.min < h.min {
+		h.min = o.min
+	}
+
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+func (h *Histogram) Min() int64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	return h.min
+}
+
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	return float64(h.sum) / float64(h.count)
+}
+
+// Quantile returns the value below or at which the fraction q of all
+// recorded values fall.
+func (h *Histogram) Quantile(q float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(q * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := histValue(i)
+			if v > h.max {
+				return h.max
+			}
+
+			return v
+		}
+	}
+
+	return h.max
+}
+
+// CountBelow returns how many recorded values are at or below v.
+func (h *Histogram) CountBelow(v int64) int64 {
+	var seen int64
+	for i, c := range h.counts {
+		if histValue(i) > v {
+			break
+		}
+
+		seen += c
+	}
+
+	return seen
+}
+
+func (h *Histogram) Sum() int64 {
+	return h.sum
+}
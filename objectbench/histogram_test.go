@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Every value falls into the bucket whose bounds enclose it and is reported
+// within 1% of itself.
+func TestHistIndex(t *testing.T) {
+	values := []int64{0, 1, histSub - 1, histSub, histSub + 1, 2*histSub - 1, 2 * histSub, 1000, 1 << 20, 1<<20 - 1, 1<<20 + 1, math.MaxInt64 >> 1}
+	for i := 0; i < 100000; i++ {
+		values = append(values, rand.Int63n(1<<uint(rand.Intn(50)+1)))
+	}
+
+	for _, v := range values {
+		i := histIndex(v)
+		if histValue(i) < v {
+			t.Fatalf("%d: bucket %d ends at %d", v, i, histValue(i))
+		}
+
+		if i > 0 && histValue(i-1) >= v {
+			t.Fatalf("%d: bucket %d before %d ends at %d", v, i-1, i, histValue(i-1))
+		}
+
+		if v > 0 && float64(histValue(i)-v)/float64(v) > 0.01 {
+			t.Fatalf("%d: reported as %d", v, histValue(i))
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram()
+	if h.Quantile(0.5) != 0 || h.Min() != 0 || h.Mean() != 0 {
+		t.Errorf("empty histogram reports %d %d %v", h.Quantile(0.5), h.Min(), h.Mean())
+	}
+
+	for v := int64(1); v <= 10000; v++ {
+		h.Record(v)
+	}
+
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		expected := q * 10000
+		if got := float64(h.Quantile(q)); math.Abs(got-expected)/expected > 0.01 {
+			t.Errorf("p%v is %v, expected %v", q*100, got, expected)
+		}
+	}
+
+	if h.Count() != 10000 || h.Min() != 1 || h.Max() != 10000 || h.Mean() != 5000.5 || h.Quantile(1) != 10000 {
+		t.Errorf("count %d min %d max %d mean %v p100 %d", h.Count(), h.Min(), h.Max(), h.Mean(), h.Quantile(1))
+	}
+
+	if below := h.CountBelow(100); below != 100 {
+		t.Errorf("%d values at or below 100", below)
+	}
+
+	h.Record(-5)
+	if h.Min() != 0 {
+		t.Errorf("negative values count as %d", h.Min())
+	}
+
+	o := NewHistogram()
+	o.Record(1 << 30)
+	h.Merge(o)
+	if h.Count() != 10002 || h.Max() != 1<<30 || h.Sum() != 50005000+1<<30 {
+		t.Errorf("merged count %d max %d sum %d", h.Count(), h.Max(), h.Sum())
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// keyEpoch is the time of object 0 of the date key strategy.
+var keyEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// objectKey names object n of a job by its KeyStrategy:
+//
+//	sequential  <prefix>42
+//	random      <prefix>a5e1f2c4b7d90e13, a random looking hex name per n
+//	hashed      <prefix>9c1e/42, spread over 65536 hashed prefixes
+//	date        <prefix>2020/01/01/00/42, one object per second from keyEpoch
+//	            so every hour partition holds 3600 objects
+//
+// The names only depend on n, so a later job finds the objects again.
+func (job *Job) objectKey(n int64) string {
+	switch job.KeyStrategy {
+	case "random":
+		return fmt.Sprintf("%s%016x", job.Keyprefix, splitmix(uint64(n)))
+	case "hashed":
+		return fmt.Sprintf("%s%04x/%d", job.Keyprefix, splitmix(uint64(n))>>48, n)
+	case "date":
+		return fmt.Sprintf("%s%s/%d", job.Keyprefix, keyEpoch.Add(time.Duration(n)*time.Second).Format("2006/01/02/15"), n)
+	}
+
+	return fmt.Sprintf("%s%d", job.Keyprefix, n)
+}
+
+// Keyspace holds the keys a mixed workload can read, list or delete. Puts
+// allocate new keys after the highest one handed out so far. With zipf the
+// keys handed out first are picked far more often than the later ones.
+type Keyspace struct {
+	name  func(n int64) string
+	zipf  float64
+	rand  *rand.Rand
+	keys  []string
+	known map[string]bool
+	next  int64
+	mu    sync.Mutex
+}
+
+func NewKeyspace(existing int64, name func(n int64) string, zipf float64) *Keyspace {
+	k := &Keyspace{
+		name: name,
+		zipf: zipf,
+		rand: rand.New(rand.NewSource(rand.Int63())),
+		keys: make([]string, 0, existing),
+		next: existing,
+	}
+
+	for i := int64(1); i <= existing; i++ {
+		k.keys = append(k.keys, name(i))
+	}
+
+	return k
+}
+
+func (k *Keyspace) New() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.next++
+	return k.name(k.next)
+}
+
+func (k *Keyspace) Add(key string) {
+	k.mu.Lock()
+	k.keys = append(k.keys, key)
+	k.mu.Unlock()
+}
+
+// Written records a key a job wrote for the jobs reading from it. A job that
+// writes the same keys again, by duration or with zipf, adds every key once,
+// so the keyspace never holds more keys than the job has.
+func (k *Keyspace) Written(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.known == nil {
+		k.known = make(map[string]bool)
+	}
+
+	if k.known[key] {
+		return
+	}
+
+	k.known[key] = true
+	k.keys = append(k.keys, key)
+}
+
+func (k *Keyspace) Pick() (string, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.keys) == 0 {
+		return "", false
+	}
+
+	if k.zipf > 0 && len(k.keys) > 1 {
+		return k.keys[rand.NewZipf(k.rand, k.zipf, 1, uint64(len(k.keys)-1)).Uint64()], true
+	}
+
+	return k.keys[rand.Intn(len(k.keys))], true
+}
+
+// Take removes a random key so that no other worker picks it for deletion.
+func (k *Keyspace) Take() (string, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.keys) == 0 {
+		return "", false
+	}
+
+	i := rand.Intn(len(k.keys))
+	key := k.keys[i]
+	k.keys[i] = k.keys[len(k.keys)-1]
+	k.keys = k.keys[:len(k.keys)-1]
+	return key, true
+}
+
+// At returns the i-th key, wrapping around at the end.
+func (k *Keyspace) At(i int64) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.keys) == 0 {
+		return ""
+	}
+
+	return k.keys[i%int64(len(k.keys))]
+}
+
+func (k *Keyspace) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.keys)
+}
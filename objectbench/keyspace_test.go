@@ -0,0 +1,126 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestObjectKey(t *testing.T) {
+	for _, c := range []struct {
+		strategy string
+		n        int64
+		pattern  string
+	}{
+		{"", 42, `^p/42$`},
+		{"sequential", 42, `^p/42$`},
+		{"random", 42, `^p/[0-9a-f]{16}$`},
+		{"hashed", 42, `^p/[0-9a-f]{4}/42$`},
+		{"date", 42, `^p/2020/01/01/00/42$`},
+		{"date", 3600, `^p/2020/01/01/01/3600$`},
+		{"date", 86400, `^p/2020/01/02/00/86400$`},
+	} {
+		job := &Job{Keyprefix: "p/", KeyStrategy: c.strategy}
+		key := job.objectKey(c.n)
+		if !regexp.MustCompile(c.pattern).MatchString(key) {
+			t.Errorf("%s %d: %s is not like %s", c.strategy, c.n, key, c.pattern)
+		}
+
+		if job.objectKey(c.n) != key {
+			t.Errorf("%s %d: the key changes", c.strategy, c.n)
+		}
+	}
+
+	for _, strategy := range []string{"random", "hashed"} {
+		job := &Job{Keyprefix: "p/", KeyStrategy: strategy}
+		keys := make(map[string]bool)
+		for n := int64(1); n <= 10000; n++ {
+			keys[job.objectKey(n)] = true
+		}
+
+		if len(keys) != 10000 {
+			t.Errorf("%s: %d keys for 10000 objects", strategy, len(keys))
+		}
+	}
+}
+
+// With zipf the keys handed out first are the hot spot.
+func TestKeyspaceZipf(t *testing.T) {
+	job := &Job{Keyprefix: "p/"}
+	k := NewKeyspace(100, job.objectKey, 2)
+	picks := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		key, _ := k.Pick()
+		picks[key]++
+	}
+
+	if picks["p/1"] < 5000 || picks["p/1"] < 10*picks["p/10"] {
+		t.Errorf("p/1 picked %d times, p/10 %d times of 10000", picks["p/1"], picks["p/10"])
+	}
+
+	uniform := NewKeyspace(100, job.objectKey, 0)
+	picks = make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		key, _ := uniform.Pick()
+		picks[key]++
+	}
+
+	if picks["p/1"] > 300 {
+		t.Errorf("p/1 picked %d times of 10000 without zipf", picks["p/1"])
+	}
+}
+
+func TestKeyspace(t *testing.T) {
+	job := &Job{Keyprefix: "p/"}
+	k := NewKeyspace(2, job.objectKey, 0)
+	if key := k.New(); key != "p/3" {
+		t.Errorf("new key %s after 2 existing", key)
+	}
+
+	k.Written("p/3")
+	k.Written("p/3")
+	if k.Len() != 3 {
+		t.Errorf("%d keys", k.Len())
+	}
+
+	taken := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		key, ok := k.Take()
+		if !ok || taken[key] {
+			t.Errorf("took %s again", key)
+		}
+
+		taken[key] = true
+	}
+
+	if _, ok := k.Take(); ok || k.Len() != 0 {
+		t.Errorf("took a key of an empty keyspace")
+	}
+
+	if _, ok := k.Pick(); ok {
+		t.Errorf("picked a key of an empty keyspace")
+	}
+}
+
+func TestValidateKeys(t *testing.T) {
+	for _, c := range []struct {
+		fields  string
+		message string
+	}{
+		{`"key_strategy": "uuid"`, `key_strategy: unknown strategy "uuid"`},
+		{`"key_strategy": "hashed", "fanout": 2`, "key_strategy: a fanout names the keys after the tree"},
+		{`"zipf": 1`, "zipf: 1 must be more than 1"},
+	} {
+		expectConfigError(t, `[{"bucket": "b", "objectsize": "1K", "operation": "put", "count": 1, "results": "r.csv", `+c.fields+`}]`, c.message)
+	}
+}
+
+// The keys a job writes with a strategy are found again by a zipf reader.
+func TestHashedKeysZipf(t *testing.T) {
+	s := runTestJobs(t,
+		map[string]interface{}{"name": "hashed", "bucket": "it", "keyprefix": "hashed/", "objectsize": "1K", "workers": 4, "operation": "put", "count": 20, "key_strategy": "hashed", "results": "put"},
+		map[string]interface{}{"after": "hashed", "bucket": "it", "keyprefix": "hashed/", "objectsize": "1K", "workers": 2, "operation": "get", "count": 20, "key_strategy": "hashed", "zipf": 1.5, "results": "get"},
+	)
+
+	expectOps(t, "put", s["put"], counts{"put": {20, 0}})
+	expectOps(t, "get", s["get"], counts{"get": {20, 0}})
+}
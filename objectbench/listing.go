@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// With a fanout the keys of a job form a tree below the Keyprefix, Depth
+// levels of Fanout directories with LeafObjects objects in every leaf, e.g.
+// <prefix>d0/d3/o1. A put job populates the tree, the other operations read
+// it.
+func (job *Job) treeSize() int64 {
+	n := int64(job.LeafObjects)
+	for i := 0; i < job.Depth; i++ {
+		n *= int64(job.Fanout)
+		if n > 1<<40 {
+			return -1
+		}
+	}
+
+	return n
+}
+
+func (job *Job) key(current int64) string {
+	if job.input != nil {
+		return job.input.At(current - 1)
+	}
+
+	if job.Fanout == 0 {
+		return job.objectKey(current)
+	}
+
+	n := (current - 1) % job.treeSize()
+	leaf, object := n/int64(job.LeafObjects), n%int64(job.LeafObjects)
+	dirs := make([]string, job.Depth)
+	for i := job.Depth - 1; i >= 0; i-- {
+		dirs[i] = fmt.Sprintf("d%d/", leaf%int64(job.Fanout))
+		leaf /= int64(job.Fanout)
+	}
+
+	return fmt.Sprintf("%s%so%d", job.Keyprefix, strings.Join(dirs, ""), object)
+}
+
+// dir returns the directory of a key at a random level of the tree, the
+// Keyprefix itself is level 0.
+func (job *Job) dir(filename string) string {
+	if job.Fanout == 0 {
+		return job.Keyprefix
+	}
+
+	dirs := strings.Split(strings.TrimPrefix(filename, job.Keyprefix), "/")
+	level := rand.Intn(len(dirs))
+	return job.Keyprefix + strings.Join(append(dirs[:level], ""), "/")
+}
+
+// listwalk pages through all keys below a directory of the tree.
+func (job *Job) listwalk(filename string) Result {
+	return job.walk("listwalk", job.dir(filename), "")
+}
+
+// listdir pages through the entries of a directory of the tree with a "/"
+// delimiter, which returns the subdirectories as common prefixes.
+func (job *Job) listdir(filename string) Result {
+	return job.walk("listdir", job.dir(filename), "/")
+}
+
+// walk measures every page of a listing as <op>_page, those results carry the
+// number of keys returned. The result of the op covers the whole listing.
+func (job *Job) walk(op string, prefix string, delimiter string) Result {
+	t := time.Now()
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(job.Bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+
+	if job.PageSize > 0 {
+		input.MaxKeys = aws.Int64(int64(job.PageSize))
+	}
+
+	var pages []Result
+	var keys int64
+	for {
+		pt := time.Now()
+		out, err := job.svc.ListObjectsV2(input)
+		if err != nil {
+			page := job.failed(op+"_page", prefix, pt, err, fmt.Sprintf("Unable to list %q in %q, %v", prefix, job.Bucket, err))
+			r := job.aborted(op, prefix, t, page)
+			r.parts = append(pages, page)
+			return r
+		}
+
+		n := int64(len(out.Contents) + len(out.CommonPrefixes))
+		page := job.request(op+"_page", prefix, fmt.Sprintf("%dkeys", n), pt)
+		page.Keys = n
+		pages = append(pages, page)
+		keys += n
+		if !aws.BoolValue(out.IsTruncated) {
+			break
+		}
+
+		input.ContinuationToken = out.NextContinuationToken
+	}
+
+	r := job.request(op, prefix, fmt.Sprintf("%dkeys", keys), t)
+	r.parts = pages
+	return r
+}
+
+type ListSummary struct {
+	Pages       int64       `json:"pages"`
+	Keys        int64       `json:"keys"`
+	PagesPerSec float64     `json:"pages_per_sec"`
+	KeysPerSec  float64     `json:"keys_per_sec"`
+	PageLatency Percentiles `json:"page_latency_ms"`
+}
+
+// summarizeListing reports the rates of the operations returning keys, one
+// op is one page.
+func summarizeListing(stats map[string]*OpStats, elapsed time.Duration) map[string]*ListSummary {
+	if elapsed <= 0 {
+		return nil
+	}
+
+	listing := make(map[string]*ListSummary)
+	for name, s := range stats {
+		if s.Keys == 0 {
+			continue
+		}
+
+		listing[name] = &ListSummary{
+			Pages:       s.Latency.Count(),
+			Keys:        s.Keys,
+			PagesPerSec: float64(s.Latency.Count()) / elapsed.Seconds(),
+			KeysPerSec:  float64(s.Keys) / elapsed.Seconds(),
+			PageLatency: percentilesOf(s.Latency),
+		}
+	}
+
+	if len(listing) == 0 {
+		return nil
+	}
+
+	return listing
+}
+
+func printListing(name string, listing map[string]*ListSummary) {
+	names := make([]string, 0, len(listing))
+	for op := range listing {
+		names = append(names, op)
+	}
+
+	sort.Strings(names)
+	fmt.Println("job,operation,pages,keys,pages/s,keys/s,p50ms,p90ms,p99ms,maxms")
+	for _, op := range names {
+		l := listing[op]
+		fmt.Printf("%s,%s,%d,%d,%.2f,%.2f,%.3f,%.3f,%.3f,%.3f\n", name, op, l.Pages, l.Keys, l.PagesPerSec, l.KeysPerSec, l.PageLatency.P50, l.PageLatency.P90, l.PageLatency.P99, l.PageLatency.Max)
+	}
+}
@@ -0,0 +1,945 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var localS3 = flag.Bool("local-s3", false, "Run against an embedded in-memory S3 server instead of -endpoint")
+var localS3Listen = flag.String("local-s3-listen", "127.0.0.1:0", "Address of the embedded S3 server")
+var localS3Latency = flag.Duration("local-s3-latency", 0, "Latency the embedded S3 server adds to every request")
+var localS3Errors = flag.Float64("local-s3-errors", 0, "Fraction of requests the embedded S3 server fails with SlowDown or InternalError")
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+type localObject struct {
+	data     []byte
+	etag     string
+	modified time.Time
+	metadata http.Header
+	version  string
+}
+
+type localUpload struct {
+	bucket    string
+	key       string
+	parts     map[int][]byte
+	initiated time.Time
+	metadata  http.Header
+}
+
+// LocalS3 is a small in-memory S3 server for offline runs. It understands path
+// style requests for objects, ListObjectsV2, DeleteObjects, multipart uploads,
+// ListMultipartUploads, bucket versioning and ListObjectVersions and ignores
+// signatures. Buckets are created by the first object written to them.
+// Deleting a versioned object without a version removes it without leaving a
+// delete marker.
+type LocalS3 struct {
+	buckets   map[string]map[string]*localObject
+	uploads   map[string]*localUpload
+	versioned map[string]bool
+	versions  map[string][]*localObject
+	nextId    int64
+	latency   time.Duration
+	errorRate float64
+	mu        sync.Mutex
+}
+
+func NewLocalS3(latency time.Duration, errorRate float64) *LocalS3 {
+	return &LocalS3{
+		buckets:   make(map[string]map[string]*localObject),
+		uploads:   make(map[string]*localUpload),
+		versioned: make(map[string]bool),
+		versions:  make(map[string][]*localObject),
+		latency:   latency,
+		errorRate: errorRate,
+	}
+}
+
+// startLocalS3 starts the embedded server and points the endpoint at it.
+func startLocalS3() {
+	listener, err := net.Listen("tcp", *localS3Listen)
+	if err != nil {
+		exitErrorf("Unable to start the local S3 server %v", err)
+	}
+
+	go http.Serve(listener, NewLocalS3(*localS3Latency, *localS3Errors))
+	*endpoint = "http://" + listener.Addr().String()
+	*nossl = true
+	*pathstyle = true
+	fmt.Println("Local S3 server listening on", *endpoint)
+}
+
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestId string
+}
+
+func (l *LocalS3) fail(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	id := strconv.FormatInt(rand.Int63(), 16)
+	w.Header().Set("x-amz-request-id", id)
+	if r.Method == "HEAD" {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	raw, _ := xml.Marshal(s3Error{Code: code, Message: message, Resource: r.URL.Path, RequestId: id})
+	w.Write([]byte(xml.Header))
+	w.Write(raw)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	raw, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(raw)
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (l *LocalS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if l.latency > 0 {
+		time.Sleep(l.latency)
+	}
+
+	if l.errorRate > 0 && rand.Float64() < l.errorRate {
+		if rand.Intn(2) == 0 {
+			l.fail(w, r, http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate.")
+		} else {
+			l.fail(w, r, http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+		}
+
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	if bucket == "" {
+		l.fail(w, r, http.StatusBadRequest, "InvalidRequest", "Listing buckets is not supported.")
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == "PUT" && query["versioning"] != nil:
+		l.putVersioning(w, r, bucket)
+	case key == "" && r.Method == "GET" && query["versioning"] != nil:
+		l.getVersioning(w, r, bucket)
+	case key == "" && r.Method == "GET" && query["versions"] != nil:
+		l.listVersions(w, r, bucket)
+	case key == "" && r.Method == "PUT":
+		l.mu.Lock()
+		if _, ok := l.buckets[bucket]; !ok {
+			l.buckets[bucket] = make(map[string]*localObject)
+		}
+		l.mu.Unlock()
+	case key == "" && r.Method == "GET" && query.Get("list-type") == "2":
+		l.listObjects(w, r, bucket)
+	case key == "" && r.Method == "GET" && query["uploads"] != nil:
+		l.listUploads(w, r, bucket)
+	case key == "" && r.Method == "POST" && query["delete"] != nil:
+		l.deleteObjects(w, r, bucket)
+	case key == "":
+		l.fail(w, r, http.StatusNotImplemented, "NotImplemented", "The bucket operation is not supported.")
+	case r.Method == "POST" && query["uploads"] != nil:
+		l.createUpload(w, r, bucket, key)
+	case r.Method == "PUT" && query.Get("uploadId") != "":
+		l.uploadPart(w, r, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == "POST" && query.Get("uploadId") != "":
+		l.completeUpload(w, r, bucket, key, query.Get("uploadId"))
+	case r.Method == "DELETE" && query.Get("uploadId") != "":
+		l.abortUpload(w, r, query.Get("uploadId"))
+	case r.Method == "PUT":
+		l.putObject(w, r, bucket, key)
+	case r.Method == "GET" || r.Method == "HEAD":
+		l.getObject(w, r, bucket, key)
+	case r.Method == "DELETE":
+		l.deleteObject(w, r, bucket, key)
+	default:
+		l.fail(w, r, http.StatusNotImplemented, "NotImplemented", "The object operation is not supported.")
+	}
+}
+
+func userMetadata(h http.Header) http.Header {
+	metadata := make(http.Header)
+	for name, values := range h {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			metadata[name] = values
+		}
+	}
+
+	return metadata
+}
+
+func (l *LocalS3) store(bucket string, key string, object *localObject) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	objects, ok := l.buckets[bucket]
+	if !ok {
+		objects = make(map[string]*localObject)
+		l.buckets[bucket] = objects
+	}
+
+	if l.versioned[bucket] {
+		l.nextId++
+		object.version = strconv.FormatInt(l.nextId, 36)
+		l.versions[bucket+"/"+key] = append(l.versions[bucket+"/"+key], object)
+	}
+
+	objects[key] = object
+}
+
+func (l *LocalS3) putObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		l.fail(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	object := &localObject{data: data, etag: etagOf(data), modified: time.Now(), metadata: userMetadata(r.Header)}
+	l.store(bucket, key, object)
+	if object.version != "" {
+		w.Header().Set("x-amz-version-id", object.version)
+	}
+
+	w.Header().Set("ETag", object.etag)
+}
+
+func (l *LocalS3) lookup(w http.ResponseWriter, r *http.Request, bucket string, key string) *localObject {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	objects, ok := l.buckets[bucket]
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return nil
+	}
+
+	if version := r.URL.Query().Get("versionId"); version != "" {
+		for _, object := range l.versions[bucket+"/"+key] {
+			if object.version == version {
+				return object
+			}
+		}
+
+		l.fail(w, r, http.StatusNotFound, "NoSuchVersion", "The specified version does not exist.")
+		return nil
+	}
+
+	object, ok := objects[key]
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return nil
+	}
+
+	return object
+}
+
+func (l *LocalS3) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	object := l.lookup(w, r, bucket, key)
+	if object == nil {
+		return
+	}
+
+	for name, values := range object.metadata {
+		w.Header()[name] = values
+	}
+
+	size := int64(len(object.data))
+	start, end := int64(0), size-1
+	status := http.StatusOK
+	if spec := r.Header.Get("Range"); spec != "" && size > 0 {
+		var ok bool
+		start, end, ok = parseRange(spec, size)
+		if !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			l.fail(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+
+	if object.version != "" {
+		w.Header().Set("x-amz-version-id", object.version)
+	}
+
+	w.Header().Set("ETag", object.etag)
+	w.Header().Set("Last-Modified", object.modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(status)
+	if r.Method == "GET" {
+		w.Write(object.data[start : end+1])
+	}
+}
+
+func parseRange(spec string, size int64) (int64, int64, bool) {
+	if !strings.HasPrefix(spec, "bytes=") || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+
+	bounds := strings.SplitN(strings.TrimPrefix(spec, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+
+	if bounds[0] == "" {
+		n, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+
+		if n > size {
+			n = size
+		}
+
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if bounds[1] != "" {
+		end, err = strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end, true
+}
+
+// remove deletes the object or one of its versions, the caller holds the lock.
+// The version null is an object written before versioning was enabled.
+func (l *LocalS3) remove(objects map[string]*localObject, bucket string, key string, version string) {
+	if version == "" {
+		delete(objects, key)
+		return
+	}
+
+	if version == "null" {
+		if o := objects[key]; o != nil && o.version == "" {
+			delete(objects, key)
+		}
+
+		return
+	}
+
+	versions := l.versions[bucket+"/"+key]
+	for i, object := range versions {
+		if object.version != version {
+			continue
+		}
+
+		versions = append(versions[:i], versions[i+1:]...)
+		l.versions[bucket+"/"+key] = versions
+		if objects[key] == object && len(versions) > 0 {
+			objects[key] = versions[len(versions)-1]
+		} else if objects[key] == object {
+			delete(objects, key)
+		}
+
+		break
+	}
+
+	if len(versions) == 0 {
+		delete(l.versions, bucket+"/"+key)
+	}
+}
+
+func (l *LocalS3) deleteObject(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	version := r.URL.Query().Get("versionId")
+	l.mu.Lock()
+	objects, ok := l.buckets[bucket]
+	if ok {
+		l.remove(objects, bucket, key, version)
+	}
+	l.mu.Unlock()
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+
+	if version != "" {
+		w.Header().Set("x-amz-version-id", version)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type listContent struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	Contents              []listContent
+	CommonPrefixes        []commonPrefix
+}
+
+func (l *LocalS3) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := 1000
+	if v := query.Get("max-keys"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	after := query.Get("start-after")
+	if token := query.Get("continuation-token"); token != "" {
+		raw, err := hex.DecodeString(token)
+		if err != nil {
+			l.fail(w, r, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect.")
+			return
+		}
+
+		after = string(raw)
+	}
+
+	l.mu.Lock()
+	objects, ok := l.buckets[bucket]
+	var keys []string
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+
+	result := listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           maxKeys,
+	}
+
+	sort.Strings(keys)
+	last := ""
+	for _, key := range keys {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if common == last {
+					continue
+				}
+
+				if result.KeyCount == maxKeys {
+					result.IsTruncated = true
+					break
+				}
+
+				last = common
+				result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: common})
+				result.KeyCount++
+				result.NextContinuationToken = hex.EncodeToString([]byte(common + "\xff"))
+				continue
+			}
+		}
+
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		object := objects[key]
+		result.Contents = append(result.Contents, listContent{
+			Key:          key,
+			LastModified: object.modified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         object.etag,
+			Size:         int64(len(object.data)),
+			StorageClass: "STANDARD",
+		})
+		result.KeyCount++
+		result.NextContinuationToken = hex.EncodeToString([]byte(key))
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	writeXML(w, result)
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+func (l *LocalS3) createUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	l.mu.Lock()
+	l.nextId++
+	id := fmt.Sprintf("%x", l.nextId)
+	l.uploads[id] = &localUpload{
+		bucket:    bucket,
+		key:       key,
+		parts:     make(map[int][]byte),
+		initiated: time.Now(),
+		metadata:  userMetadata(r.Header),
+	}
+	l.mu.Unlock()
+	writeXML(w, initiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadId: id})
+}
+
+func (l *LocalS3) uploadPart(w http.ResponseWriter, r *http.Request, id string, number string) {
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > 10000 {
+		l.fail(w, r, http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000.")
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		l.fail(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	l.mu.Lock()
+	upload, ok := l.uploads[id]
+	if ok {
+		upload.parts[n] = data
+	}
+	l.mu.Unlock()
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+
+	w.Header().Set("ETag", etagOf(data))
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string
+	Key     string
+	ETag    string
+}
+
+func (l *LocalS3) completeUpload(w http.ResponseWriter, r *http.Request, bucket string, key string, id string) {
+	var complete completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+		l.fail(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	l.mu.Lock()
+	upload, ok := l.uploads[id]
+	if ok {
+		delete(l.uploads, id)
+	}
+	l.mu.Unlock()
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+
+	var data bytes.Buffer
+	sums := md5.New()
+	for i, part := range complete.Parts {
+		body, found := upload.parts[part.PartNumber]
+		if !found || etagOf(body) != part.ETag || (i > 0 && part.PartNumber <= complete.Parts[i-1].PartNumber) {
+			l.fail(w, r, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+			return
+		}
+
+		data.Write(body)
+		sum := md5.Sum(body)
+		sums.Write(sum[:])
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), len(complete.Parts))
+	l.store(bucket, key, &localObject{data: data.Bytes(), etag: etag, modified: time.Now(), metadata: upload.metadata})
+	writeXML(w, completeMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, ETag: etag})
+}
+
+func (l *LocalS3) abortUpload(w http.ResponseWriter, r *http.Request, id string) {
+	l.mu.Lock()
+	_, ok := l.uploads[id]
+	delete(l.uploads, id)
+	l.mu.Unlock()
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type listUpload struct {
+	Key          string
+	UploadId     string
+	Initiated    string
+	StorageClass string
+}
+
+type listMultipartUploadsResult struct {
+	XMLName            xml.Name `xml:"ListMultipartUploadsResult"`
+	Xmlns              string   `xml:"xmlns,attr"`
+	Bucket             string
+	Prefix             string
+	KeyMarker          string
+	UploadIdMarker     string
+	NextKeyMarker      string `xml:",omitempty"`
+	NextUploadIdMarker string `xml:",omitempty"`
+	MaxUploads         int
+	IsTruncated        bool
+	Uploads            []listUpload `xml:"Upload"`
+}
+
+// listUploads lists the uploads of a bucket ordered by key and upload id.
+func (l *LocalS3) listUploads(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	keyMarker := query.Get("key-marker")
+	idMarker := query.Get("upload-id-marker")
+	maxUploads := 1000
+	if v := query.Get("max-uploads"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < maxUploads {
+			maxUploads = n
+		}
+	}
+
+	result := listMultipartUploadsResult{
+		Xmlns:          s3Namespace,
+		Bucket:         bucket,
+		Prefix:         prefix,
+		KeyMarker:      keyMarker,
+		UploadIdMarker: idMarker,
+		MaxUploads:     maxUploads,
+	}
+
+	l.mu.Lock()
+	var ids []string
+	for id, upload := range l.uploads {
+		if upload.bucket != bucket || !strings.HasPrefix(upload.key, prefix) {
+			continue
+		}
+
+		if upload.key < keyMarker || (upload.key == keyMarker && (idMarker == "" || id <= idMarker)) {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := l.uploads[ids[i]], l.uploads[ids[j]]
+		if a.key != b.key {
+			return a.key < b.key
+		}
+
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		if len(result.Uploads) == maxUploads {
+			result.IsTruncated = true
+			break
+		}
+
+		upload := l.uploads[id]
+		result.Uploads = append(result.Uploads, listUpload{
+			Key:          upload.key,
+			UploadId:     id,
+			Initiated:    upload.initiated.UTC().Format("2006-01-02T15:04:05.000Z"),
+			StorageClass: "STANDARD",
+		})
+		result.NextKeyMarker = upload.key
+		result.NextUploadIdMarker = id
+	}
+	l.mu.Unlock()
+
+	if !result.IsTruncated {
+		result.NextKeyMarker = ""
+		result.NextUploadIdMarker = ""
+	}
+
+	writeXML(w, result)
+}
+
+type deleteRequest struct {
+	Quiet   bool
+	Objects []struct {
+		Key       string
+		VersionId string
+	} `xml:"Object"`
+}
+
+type deletedObject struct {
+	Key       string
+	VersionId string `xml:",omitempty"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Deleted []deletedObject `xml:"Deleted"`
+}
+
+func (l *LocalS3) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	var request deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		l.fail(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	if len(request.Objects) > 1000 {
+		l.fail(w, r, http.StatusBadRequest, "MalformedXML", "At most 1000 keys can be deleted at once.")
+		return
+	}
+
+	result := deleteResult{Xmlns: s3Namespace}
+	l.mu.Lock()
+	objects := l.buckets[bucket]
+	for _, o := range request.Objects {
+		l.remove(objects, bucket, o.Key, o.VersionId)
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: o.Key, VersionId: o.VersionId})
+		}
+	}
+	l.mu.Unlock()
+
+	writeXML(w, result)
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:",omitempty"`
+}
+
+func (l *LocalS3) putVersioning(w http.ResponseWriter, r *http.Request, bucket string) {
+	var config versioningConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		l.fail(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	if config.Status != "Enabled" && config.Status != "Suspended" {
+		l.fail(w, r, http.StatusBadRequest, "IllegalVersioningConfigurationException", "The versioning status must be Enabled or Suspended.")
+		return
+	}
+
+	l.mu.Lock()
+	if _, ok := l.buckets[bucket]; !ok {
+		l.buckets[bucket] = make(map[string]*localObject)
+	}
+
+	l.versioned[bucket] = config.Status == "Enabled"
+	l.mu.Unlock()
+}
+
+func (l *LocalS3) getVersioning(w http.ResponseWriter, r *http.Request, bucket string) {
+	config := versioningConfiguration{Xmlns: s3Namespace}
+	l.mu.Lock()
+	versioned, ok := l.versioned[bucket]
+	l.mu.Unlock()
+	if versioned {
+		config.Status = "Enabled"
+	} else if ok {
+		config.Status = "Suspended"
+	}
+
+	writeXML(w, config)
+}
+
+type listVersion struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type listVersionsResult struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	Xmlns               string   `xml:"xmlns,attr"`
+	Name                string
+	Prefix              string
+	KeyMarker           string
+	VersionIdMarker     string
+	NextKeyMarker       string `xml:",omitempty"`
+	NextVersionIdMarker string `xml:",omitempty"`
+	MaxKeys             int
+	IsTruncated         bool
+	Versions            []listVersion `xml:"Version"`
+}
+
+// listVersions lists the versions of every key newest first, objects written
+// before versioning was enabled have the version null.
+func (l *LocalS3) listVersions(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	keyMarker := query.Get("key-marker")
+	versionMarker := query.Get("version-id-marker")
+	maxKeys := 1000
+	if v := query.Get("max-keys"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	result := listVersionsResult{
+		Xmlns:           s3Namespace,
+		Name:            bucket,
+		Prefix:          prefix,
+		KeyMarker:       keyMarker,
+		VersionIdMarker: versionMarker,
+		MaxKeys:         maxKeys,
+	}
+
+	l.mu.Lock()
+	objects, ok := l.buckets[bucket]
+	seen := make(map[string]bool)
+	var keys []string
+	for key := range objects {
+		seen[key] = true
+		keys = append(keys, key)
+	}
+
+	for name := range l.versions {
+		if key := strings.TrimPrefix(name, bucket+"/"); len(key) < len(name) && !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key < keyMarker || (key == keyMarker && versionMarker == "") {
+			continue
+		}
+
+		versions := l.versions[bucket+"/"+key]
+		if len(versions) == 0 {
+			versions = []*localObject{objects[key]}
+		}
+
+		skip := key == keyMarker
+		for i := len(versions) - 1; i >= 0; i-- {
+			object := versions[i]
+			version := object.version
+			if version == "" {
+				version = "null"
+			}
+
+			if skip {
+				skip = version != versionMarker
+				continue
+			}
+
+			if len(result.Versions) == maxKeys {
+				result.IsTruncated = true
+				break
+			}
+
+			result.Versions = append(result.Versions, listVersion{
+				Key:          key,
+				VersionId:    version,
+				IsLatest:     objects[key] == object,
+				LastModified: object.modified.UTC().Format("2006-01-02T15:04:05.000Z"),
+				ETag:         object.etag,
+				Size:         int64(len(object.data)),
+				StorageClass: "STANDARD",
+			})
+			result.NextKeyMarker = key
+			result.NextVersionIdMarker = version
+		}
+
+		if result.IsTruncated {
+			break
+		}
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		l.fail(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+
+	if !result.IsTruncated {
+		result.NextKeyMarker = ""
+		result.NextVersionIdMarker = ""
+	}
+
+	writeXML(w, result)
+}
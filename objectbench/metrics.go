@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var metrics = flag.String("metrics", "", "Serve Prometheus metrics on http://<address>/metrics e.g. :9100")
+
+// Upper bounds of the latency histogram buckets in seconds.
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			fmt.Printf("Error serving metrics on %s: %v\n", address, err)
+		}
+	}()
+}
+
+// labels name a job by its results like compare does, jobs of a matrix share
+// the bucket and keyprefix. Prometheus sets the job label of its own.
+func labels(job *Job, op string) string {
+	name := strings.TrimSuffix(filepath.Base(job.Results), filepath.Ext(job.Results))
+	return fmt.Sprintf(`bench_job="%s",target="%s",bucket="%s",keyprefix="%s",operation="%s"`, labelEscaper.Replace(name), labelEscaper.Replace(job.Target), labelEscaper.Replace(job.Bucket), labelEscaper.Replace(job.Keyprefix), labelEscaper.Replace(op))
+}
+
+// writeMetrics writes the counters and latency histograms of every job started
+// so far, so the counters of finished jobs stay, and on a controller the
+// counters per service in the Prometheus text format.
+func writeMetrics(w io.Writer) {
+	type series struct {
+		labels string
+		stats  *OpStats
+	}
+
+	var all []series
+	for _, job := range startedJobs() {
+		job.statsMu.Lock()
+		names := make([]string, 0, len(job.stats))
+		for op := range job.stats {
+			names = append(names, op)
+		}
+
+		sort.Strings(names)
+		for _, op := range names {
+			s := job.stats[op]
+			latency := NewHistogram()
+			latency.Merge(s.Latency)
+			all = append(all, series{labels(job, op), &OpStats{Latency: latency, Bytes: s.Bytes, Errors: s.Errors}})
+		}
+		job.statsMu.Unlock()
+	}
+
+	fmt.Fprintln(w, "# HELP objectbench_ops_total Successful requests.")
+	fmt.Fprintln(w, "# TYPE objectbench_ops_total counter")
+	for _, s := range all {
+		fmt.Fprintf(w, "objectbench_ops_total{%s} %d\n", s.labels, s.stats.Latency.Count())
+	}
+
+	fmt.Fprintln(w, "# HELP objectbench_bytes_total Bytes transferred.")
+	fmt.Fprintln(w, "# TYPE objectbench_bytes_total counter")
+	for _, s := range all {
+		fmt.Fprintf(w, "objectbench_bytes_total{%s} %d\n", s.labels, s.stats.Bytes)
+	}
+
+	fmt.Fprintln(w, "# HELP objectbench_errors_total Failed requests.")
+	fmt.Fprintln(w, "# TYPE objectbench_errors_total counter")
+	for _, s := range all {
+		fmt.Fprintf(w, "objectbench_errors_total{%s} %d\n", s.labels, s.stats.Errors)
+	}
+
+	fmt.Fprintln(w, "# HELP objectbench_latency_seconds Latency of successful requests.")
+	fmt.Fprintln(w, "# TYPE objectbench_latency_seconds histogram")
+	for _, s := range all {
+		for _, le := range latencyBuckets {
+			fmt.Fprintf(w, "objectbench_latency_seconds_bucket{%s,le=\"%g\"} %d\n", s.labels, le, s.stats.Latency.CountBelow(int64(le*1000000)))
+		}
+
+		fmt.Fprintf(w, "objectbench_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", s.labels, s.stats.Latency.Count())
+		fmt.Fprintf(w, "objectbench_latency_seconds_sum{%s} %g\n", s.labels, float64(s.stats.Latency.Sum())/1000000)
+		fmt.Fprintf(w, "objectbench_latency_seconds_count{%s} %d\n", s.labels, s.stats.Latency.Count())
+	}
+
+	overall.mu.Lock()
+	defer overall.mu.Unlock()
+	if len(overall.Nodes) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "# HELP objectbench_node_ops_total Successful requests published by a service.")
+	fmt.Fprintln(w, "# TYPE objectbench_node_ops_total counter")
+	for _, name := range sortedNames(overall.Nodes) {
+		fmt.Fprintf(w, "objectbench_node_ops_total{node=\"%s\"} %d\n", labelEscaper.Replace(name), overall.Nodes[name].Ops)
+	}
+
+	fmt.Fprintln(w, "# HELP objectbench_node_bytes_total Bytes transferred by a service.")
+	fmt.Fprintln(w, "# TYPE objectbench_node_bytes_total counter")
+	for _, name := range sortedNames(overall.Nodes) {
+		fmt.Fprintf(w, "objectbench_node_bytes_total{node=\"%s\"} %d\n", labelEscaper.Replace(name), overall.Nodes[name].Bytes)
+	}
+
+	fmt.Fprintln(w, "# HELP objectbench_node_errors_total Failed requests published by a service.")
+	fmt.Fprintln(w, "# TYPE objectbench_node_errors_total counter")
+	for _, name := range sortedNames(overall.Nodes) {
+		fmt.Fprintf(w, "objectbench_node_errors_total{node=\"%s\"} %d\n", labelEscaper.Replace(name), overall.Nodes[name].Errors)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Jobs of a matrix share their bucket and keyprefix, the results name them.
+func TestWriteMetrics(t *testing.T) {
+	runTestJobs(t,
+		map[string]interface{}{"bucket": "it", "keyprefix": "metrics/", "objectsize": "1K", "workers": 1, "operation": "put", "count": 3, "results": "m_1"},
+		map[string]interface{}{"bucket": "it", "keyprefix": "metrics/", "objectsize": "1K", "workers": 2, "operation": "put", "count": 5, "results": "m_2"},
+	)
+
+	var out bytes.Buffer
+	writeMetrics(&out)
+	metrics := out.String()
+	for _, line := range []string{
+		`objectbench_ops_total{bench_job="m_1",target="",bucket="it",keyprefix="metrics/",operation="put"} 3`,
+		`objectbench_ops_total{bench_job="m_2",target="",bucket="it",keyprefix="metrics/",operation="put"} 5`,
+		`objectbench_bytes_total{bench_job="m_2",target="",bucket="it",keyprefix="metrics/",operation="put"} 5120`,
+		`objectbench_latency_seconds_count{bench_job="m_1",target="",bucket="it",keyprefix="metrics/",operation="put"} 3`,
+		`objectbench_latency_seconds_bucket{bench_job="m_1",target="",bucket="it",keyprefix="metrics/",operation="put",le="+Inf"} 3`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("no %s in\n%s", line, metrics)
+		}
+	}
+
+	if strings.Contains(metrics, "{job=") {
+		t.Errorf("job label in\n%s", metrics)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// multipart drives CreateMultipartUpload, UploadPart and
+// CompleteMultipartUpload itself instead of the s3manager, so every request of
+// an upload is measured on its own. The bytes are counted by the uploadpart
+// results, the multipart result covers the whole upload. AbortPct of the
+// uploads are aborted and IncompletePct are left behind after a random number
+// of parts.
+func (job *Job) multipart(filename string) Result {
+	t := time.Now()
+	o := NewObjectInputStream(job.sizes.Size(), payloadSeed(job.Seed, job.Bucket, filename), job.payload)
+	var metadata map[string]*string
+	if job.Checksum {
+		metadata = map[string]*string{
+			"objectbench-seed":    aws.String(strconv.FormatInt(job.Seed, 10)),
+			"objectbench-payload": aws.String(o.Payload.String()),
+			"objectbench-crc64":   aws.String(strconv.FormatUint(o.Payload.Checksum(o.Seed, o.Size), 16)),
+		}
+	}
+
+	var requests []Result
+	algorithm, key := job.customerKey(filename)
+	out, err := job.svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(job.Bucket),
+		Key:                  aws.String(filename),
+		Metadata:             job.metadata(metadata),
+		ServerSideEncryption: job.serverSideEncryption(),
+		SSEKMSKeyId:          optional(job.KmsKeyId),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+		StorageClass:         optional(job.StorageClass),
+		ACL:                  optional(job.ACL),
+		ContentType:          optional(job.ContentType),
+		Tagging:              optional(job.Tagging),
+	})
+
+	if err != nil {
+		r := job.failed("createmultipart", filename, t, err, fmt.Sprintf("Unable to create upload %q in %q, %v", filename, job.Bucket, err))
+		result := job.aborted("multipart", filename, t, r)
+		result.parts = []Result{r}
+		return result
+	}
+
+	requests = append(requests, job.request("createmultipart", filename, "", t))
+	id := aws.StringValue(out.UploadId)
+	parts := int((o.Size + job.psize - 1) / job.psize)
+	if parts == 0 {
+		parts = 1
+	}
+
+	outcome := "multipart"
+	n := rand.Float64() * 100
+	switch {
+	case n < job.AbortPct:
+		outcome = "multipart_aborted"
+		parts = 1 + rand.Intn(parts)
+	case n < job.AbortPct+job.IncompletePct:
+		outcome = "multipart_incomplete"
+		parts = 1 + rand.Intn(parts)
+	}
+
+	completed := make([]*s3.CompletedPart, parts)
+	results := make([]Result, parts)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < job.Concurrency || i == 0; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range next {
+				completed[p], results[p] = job.uploadPart(o, filename, id, p)
+			}
+		}()
+	}
+
+	for p := 0; p < parts; p++ {
+		next <- p
+	}
+
+	close(next)
+	wg.Wait()
+	requests = append(requests, results...)
+	var failure *Result
+	for p := range results {
+		if results[p].Err != "ok" && failure == nil {
+			outcome = "multipart_aborted"
+			failure = &results[p]
+		}
+	}
+
+	var result Result
+	switch outcome {
+	case "multipart":
+		ct := time.Now()
+		_, err = job.svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(job.Bucket),
+			Key:             aws.String(filename),
+			UploadId:        aws.String(id),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+		})
+
+		if err != nil {
+			r := job.failed("completemultipart", filename, ct, err, fmt.Sprintf("Unable to complete upload %q in %q, %v", filename, job.Bucket, err))
+			requests = append(requests, r)
+			result = job.aborted("multipart", filename, t, r)
+			job.trackUpload(id, true)
+			break
+		}
+
+		requests = append(requests, job.request("completemultipart", filename, "", ct))
+		result = job.request("multipart", filename, bytesToUnits(o.Size), t)
+		job.trackUpload(id, false)
+	case "multipart_aborted":
+		at := time.Now()
+		_, aerr := job.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(job.Bucket),
+			Key:      aws.String(filename),
+			UploadId: aws.String(id),
+		})
+
+		if aerr != nil {
+			requests = append(requests, job.failed("abortmultipart", filename, at, aerr, fmt.Sprintf("Unable to abort upload %q in %q, %v", filename, job.Bucket, aerr)))
+			job.trackUpload(id, true)
+		} else {
+			requests = append(requests, job.request("abortmultipart", filename, "", at))
+			job.trackUpload(id, false)
+		}
+
+		if failure != nil {
+			result = job.aborted("multipart", filename, t, *failure)
+			break
+		}
+
+		result = job.request(outcome, filename, bytesToUnits(o.Size), t)
+	case "multipart_incomplete":
+		result = job.request(outcome, filename, bytesToUnits(o.Size), t)
+		job.trackUpload(id, true)
+	}
+
+	result.parts = requests
+	return result
+}
+
+func (job *Job) uploadPart(o *ObjectInputStream, filename string, id string, p int) (*s3.CompletedPart, Result) {
+	off := int64(p) * job.psize
+	size := job.psize
+	if off+size > o.Size {
+		size = o.Size - off
+	}
+
+	if size < 0 {
+		size = 0
+	}
+
+	name := fmt.Sprintf("%s#%d", filename, p+1)
+	t := time.Now()
+	algorithm, key := job.customerKey(filename)
+	out, err := job.svc.UploadPart(&s3.UploadPartInput{
+		Bucket:               aws.String(job.Bucket),
+		Key:                  aws.String(filename),
+		UploadId:             aws.String(id),
+		PartNumber:           aws.Int64(int64(p + 1)),
+		Body:                 io.NewSectionReader(payloadReader{o.Payload, o.Seed, o.Size}, off, size),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+	})
+
+	if err != nil {
+		return nil, job.failed("uploadpart", name, t, err, fmt.Sprintf("Unable to upload part %d of %q to %q, %v", p+1, filename, job.Bucket, err))
+	}
+
+	r := job.request("uploadpart", name, bytesToUnits(size), t)
+	r.Bytes = size
+	r.TransferRate = fmt.Sprintf("%s/s", bytesToUnits(int64(float64(size)/time.Since(t).Seconds())))
+	return &s3.CompletedPart{ETag: out.ETag, PartNumber: aws.Int64(int64(p + 1))}, r
+}
+
+// trackUpload remembers the uploads of the job, those left open are expected
+// in the ListMultipartUploads check, the others should be gone.
+func (job *Job) trackUpload(id string, open bool) {
+	job.uploadsMu.Lock()
+	defer job.uploadsMu.Unlock()
+	if job.uploads == nil {
+		job.uploads = make(map[string]bool)
+	}
+
+	job.uploads[id] = open
+}
+
+type UploadCheck struct {
+	Listed     int64   `json:"listed"`
+	Incomplete int64   `json:"incomplete"`
+	Found      int64   `json:"found"`
+	Missing    int64   `json:"missing"`
+	Leaked     int64   `json:"leaked"`
+	Foreign    int64   `json:"foreign"`
+	Pages      int64   `json:"pages"`
+	Seconds    float64 `json:"seconds"`
+	Err        string  `json:"error,omitempty"`
+}
+
+// checkUploads lists the multipart uploads under the job's prefix after the
+// job. The uploads left incomplete should be found, completed or aborted ones
+// are leaked if they are still listed. Foreign uploads belong to other runs.
+func (job *Job) checkUploads() {
+	job.uploadsMu.Lock()
+	defer job.uploadsMu.Unlock()
+	check := &UploadCheck{}
+	for _, open := range job.uploads {
+		if open {
+			check.Incomplete++
+		}
+	}
+
+	t := time.Now()
+	err := job.svc.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(job.Bucket),
+		Prefix: aws.String(job.Keyprefix),
+	}, func(page *s3.ListMultipartUploadsOutput, last bool) bool {
+		check.Pages++
+		for _, u := range page.Uploads {
+			check.Listed++
+			open, ok := job.uploads[aws.StringValue(u.UploadId)]
+			switch {
+			case !ok:
+				check.Foreign++
+			case open:
+				check.Found++
+			default:
+				check.Leaked++
+			}
+		}
+
+		return true
+	})
+
+	check.Seconds = time.Since(t).Seconds()
+	check.Missing = check.Incomplete - check.Found
+	if err != nil {
+		check.Err = err.Error()
+	}
+
+	job.statsMu.Lock()
+	job.uploadCheck = check
+	job.statsMu.Unlock()
+}
+
+func printUploadCheck(name string, c *UploadCheck) {
+	fmt.Println("job,listed,incomplete,found,missing,leaked,foreign,pages,seconds,error")
+	fmt.Printf("%s,%d,%d,%d,%d,%d,%d,%d,%.3f,%s\n", name, c.Listed, c.Incomplete, c.Found, c.Missing, c.Leaked, c.Foreign, c.Pages, c.Seconds, c.Err)
+}
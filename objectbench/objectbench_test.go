@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The jobs of the tests run against the embedded S3 server.
+func TestMain(m *testing.M) {
+	*localS3 = true
+	startLocalS3()
+	os.Exit(m.Run())
+}
+
+// runTestJobs runs the jobs through prepareJobs like objectbench -config does.
+// The results of a job named by "results" are written to a temporary
+// directory, its summary is returned under that name.
+func runTestJobs(t *testing.T, jobs ...map[string]interface{}) map[string]*Summary {
+	t.Helper()
+	dir := t.TempDir()
+	for _, job := range jobs {
+		job["results"] = filepath.Join(dir, job["results"].(string)+".csv")
+		if _, ok := job["errorlog"]; ok {
+			job["errorlog"] = filepath.Join(dir, job["errorlog"].(string))
+		}
+	}
+
+	raw, err := json.Marshal(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prepareJobs(raw)
+	summaries, err := loadSummaries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, job := range jobs {
+		name := filepath.Base(job["results"].(string))
+		name = name[:len(name)-len(".csv")]
+		s := summaries[name]
+		if s == nil {
+			t.Fatalf("no summary of %s", name)
+		}
+
+		// Every request is a line of the results.
+		var requests int64
+		for _, o := range s.Operations {
+			requests += o.Ops + o.Errors
+		}
+
+		if lines := countResults(t, job["results"].(string)); lines != requests {
+			t.Errorf("%s: %d results for %d requests", name, lines, requests)
+		}
+	}
+
+	return summaries
+}
+
+// countResults counts the records of a results file, the messages of errors
+// span several lines.
+func countResults(t *testing.T, path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return int64(len(records))
+}
+
+type counts map[string][2]int64
+
+// expectOps compares the ops and errors per operation of a summary.
+func expectOps(t *testing.T, name string, s *Summary, expected counts) {
+	t.Helper()
+	for op, c := range expected {
+		o := s.Operations[op]
+		if o == nil {
+			t.Errorf("%s: no %s operations", name, op)
+			continue
+		}
+
+		if o.Ops != c[0] || o.Errors != c[1] {
+			t.Errorf("%s: %s ops %d errors %d, expected %d and %d", name, op, o.Ops, o.Errors, c[0], c[1])
+		}
+	}
+
+	if len(s.Operations) != len(expected) {
+		t.Errorf("%s: operations %v", name, s.Operations)
+	}
+}
+
+func errorCount(s *Summary) int64 {
+	var n int64
+	for _, c := range s.Errors {
+		n += c
+	}
+
+	return n
+}
+
+func TestPutGetVerifyList(t *testing.T) {
+	s := runTestJobs(t,
+		map[string]interface{}{"name": "fill", "bucket": "it", "keyprefix": "objects/", "objectsize": "uniform:1K-64K", "workers": 4, "operation": "put", "count": 20, "checksum": true, "results": "put"},
+		map[string]interface{}{"from": "fill", "bucket": "it", "keyprefix": "objects/", "objectsize": "uniform:1K-64K", "workers": 4, "operation": "get", "results": "get"},
+		map[string]interface{}{"from": "fill", "bucket": "it", "keyprefix": "objects/", "objectsize": "uniform:1K-64K", "workers": 4, "operation": "verify", "results": "verify"},
+		map[string]interface{}{"after": "fill", "bucket": "it", "keyprefix": "objects/", "objectsize": "1K", "workers": 1, "operation": "list", "count": 5, "results": "list"},
+		map[string]interface{}{"after": "fill", "bucket": "it", "keyprefix": "missing/", "objectsize": "1K", "workers": 2, "operation": "get", "count": 5, "errorlog": "missing.log", "results": "missing"},
+	)
+
+	expectOps(t, "put", s["put"], counts{"put": {20, 0}})
+	expectOps(t, "get", s["get"], counts{"get": {20, 0}})
+	expectOps(t, "verify", s["verify"], counts{"verify": {20, 0}})
+	expectOps(t, "list", s["list"], counts{"list": {5, 0}})
+	expectOps(t, "missing", s["missing"], counts{"get": {0, 5}})
+	if s["put"].Operations["put"].Bytes != s["get"].Operations["get"].Bytes {
+		t.Errorf("put %d bytes, got %d", s["put"].Operations["put"].Bytes, s["get"].Operations["get"].Bytes)
+	}
+
+	if l := s["list"].Listing["list"]; l == nil || l.Keys == 0 {
+		t.Errorf("list returned no keys")
+	}
+
+	if len(s["missing"].Errors) != 1 || s["missing"].Errors["NoSuchKey"] != 5 {
+		t.Errorf("missing errors %v", s["missing"].Errors)
+	}
+
+	for _, name := range []string{"put", "get", "verify", "list"} {
+		if s[name].Errors != nil {
+			t.Errorf("%s errors %v", name, s[name].Errors)
+		}
+	}
+
+	if s["get"].Stage != 1 || s["put"].Stage != 0 {
+		t.Errorf("get in stage %d, put in %d", s["get"].Stage, s["put"].Stage)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	s := runTestJobs(t,
+		map[string]interface{}{"bucket": "it", "keyprefix": "multipart/", "objectsize": "12M", "partsize": "5M", "workers": 2, "operation": "multipart", "count": 3, "results": "multipart"},
+	)
+
+	expectOps(t, "multipart", s["multipart"], counts{
+		"createmultipart":   {3, 0},
+		"uploadpart":        {9, 0},
+		"completemultipart": {3, 0},
+		"multipart":         {3, 0},
+	})
+
+	if bytes := s["multipart"].Operations["uploadpart"].Bytes; bytes != 3*12<<20 {
+		t.Errorf("uploaded %d bytes", bytes)
+	}
+
+	if u := s["multipart"].Uploads; u == nil || u.Leaked != 0 || u.Missing != 0 || u.Incomplete != 0 {
+		t.Errorf("uploads %+v", u)
+	}
+}
+
+// on points a job at its own server instead of the embedded one.
+func on(server *httptest.Server, job map[string]interface{}) map[string]interface{} {
+	for k, v := range map[string]interface{}{"endpoint": server.URL, "accesskey": "local", "secretkey": "local", "nossl": true, "pathstyle": true} {
+		job[k] = v
+	}
+
+	return job
+}
+
+// The uploads of a mix are multipart uploads, with their aborts.
+func TestMixMultipart(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(0, 0))
+	defer server.Close()
+	s := runTestJobs(t,
+		on(server, map[string]interface{}{"bucket": "it", "keyprefix": "mixmp/", "objectsize": "6M", "partsize": "5M", "workers": 1, "mix": map[string]int{"multipart": 1}, "abort_pct": 50, "count": 4, "results": "mixmp"}),
+	)
+
+	var uploads int64
+	for name, o := range s["mixmp"].Operations {
+		switch name {
+		case "multipart", "multipart_aborted":
+			uploads += o.Ops
+		case "createmultipart", "uploadpart", "completemultipart", "abortmultipart":
+		default:
+			t.Errorf("%d %s in a mix of multipart uploads", o.Ops, name)
+		}
+	}
+
+	if uploads != 4 {
+		t.Errorf("%d of 4 uploads", uploads)
+	}
+}
+
+// The requests started in the warmup are not counted.
+func TestWarmup(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(10*time.Millisecond, 0))
+	defer server.Close()
+	s := runTestJobs(t,
+		on(server, map[string]interface{}{"bucket": "it", "keyprefix": "warmup/", "objectsize": "1K", "workers": 1, "operation": "put", "count": 30, "warmup": "100ms", "results": "warmup"}),
+	)
+
+	if o := s["warmup"].Operations["put"]; o == nil || o.Ops == 0 || o.Ops >= 30 {
+		t.Errorf("puts %+v, expected the warmup to take some of 30", o)
+	}
+}
+
+// A job with a duration runs for its warmup, rampup and duration.
+func TestDuration(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(5*time.Millisecond, 0))
+	defer server.Close()
+	start := time.Now()
+	s := runTestJobs(t,
+		on(server, map[string]interface{}{"bucket": "it", "keyprefix": "duration/", "objectsize": "1K", "workers": 2, "operation": "put", "count": 10, "duration": "300ms", "warmup": "100ms", "rampup": "100ms", "results": "duration"}),
+	)
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("the job ran for %v", elapsed)
+	}
+
+	if o := s["duration"].Operations["put"]; o == nil || o.Ops <= 10 {
+		t.Errorf("puts %+v, the count only limits the keys of a duration", o)
+	}
+}
+
+// A request that fails counts its error class once, the operation it is a
+// part of only counts as failed.
+func TestFailuresCountOnce(t *testing.T) {
+	failing := httptest.NewServer(NewLocalS3(0, 1))
+	defer failing.Close()
+	job := func(op string, results string) map[string]interface{} {
+		return on(failing, map[string]interface{}{
+			"bucket": "it", "keyprefix": "failing/", "objectsize": "6M", "partsize": "5M", "workers": 1, "operation": op, "count": 4,
+			"retries": 0, "errorlog": results + ".log", "results": results,
+		})
+	}
+
+	s := runTestJobs(t, job("multipart", "multipart"), job("listwalk", "listwalk"), job("put", "put"))
+	expectOps(t, "multipart", s["multipart"], counts{"createmultipart": {0, 4}, "multipart": {0, 4}})
+	expectOps(t, "listwalk", s["listwalk"], counts{"listwalk_page": {0, 4}, "listwalk": {0, 4}})
+	expectOps(t, "put", s["put"], counts{"put": {0, 4}})
+	for _, name := range []string{"multipart", "listwalk", "put"} {
+		if n := errorCount(s[name]); n != 4 {
+			t.Errorf("%s: %d errors by class %v, expected 4", name, n, s[name].Errors)
+		}
+
+		for class := range s[name].Errors {
+			if class != "SlowDown" && class != "InternalError" {
+				t.Errorf("%s: error class %s", name, class)
+			}
+		}
+	}
+}
+
+// The versions are kept, every run of the test starts on an empty server.
+func TestVersions(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(0, 0))
+	defer server.Close()
+	s := runTestJobs(t,
+		on(server, map[string]interface{}{"name": "versions", "bucket": "versioned", "keyprefix": "v/", "objectsize": "1K", "workers": 3, "operation": "versions", "versioning": true, "versions": 2, "count": 4, "results": "versions"}),
+		on(server, map[string]interface{}{"after": "versions", "bucket": "versioned", "keyprefix": "v/", "objectsize": "1K", "workers": 1, "operation": "get", "count": 4, "results": "get"}),
+	)
+
+	// Two rounds write the versions, a cycle reads and lists them, adds one
+	// and deletes the oldest, the latest version is left for the get.
+	expectOps(t, "versions", s["versions"], counts{
+		"put_version":    {12, 0},
+		"get_latest":     {4, 0},
+		"get_version":    {4, 0},
+		"listversions":   {4, 0},
+		"delete_version": {4, 0},
+	})
+
+	expectOps(t, "get", s["get"], counts{"get": {4, 0}})
+	if l := s["versions"].Listing["listversions"]; l == nil || l.Keys != 8 {
+		t.Errorf("listed %+v versions of 4 keys, expected 8", l)
+	}
+}
+
+// Reads and deletes of an empty keyspace fall back to puts, every request
+// of the count is one of the mix. A single worker never reads a key another
+// one deleted.
+func TestMix(t *testing.T) {
+	server := httptest.NewServer(NewLocalS3(0, 0))
+	defer server.Close()
+	s := runTestJobs(t,
+		on(server, map[string]interface{}{"bucket": "it", "keyprefix": "mix/", "objectsize": "1K", "workers": 1, "mix": map[string]int{"put": 2, "get": 5, "head": 2, "delete": 1}, "count": 200, "results": "mix"}),
+	)
+
+	var ops int64
+	for name, o := range s["mix"].Operations {
+		if o.Errors != 0 {
+			t.Errorf("%s: %d errors", name, o.Errors)
+		}
+
+		ops += o.Ops
+	}
+
+	if ops != 200 {
+		t.Errorf("%d ops, expected 200", ops)
+	}
+
+	if o := s["mix"].Operations["get"]; o == nil || o.Ops < 50 {
+		t.Errorf("gets %+v of 200 ops weighted 5 of 10", o)
+	}
+
+	if o := s["mix"].Operations["put"]; o == nil || o.Ops < 20 {
+		t.Errorf("puts %+v of 200 ops", o)
+	}
+}
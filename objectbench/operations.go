@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"hash/crc64"
+	"io"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+var operations = map[string]func(*Job, string) Result{
+	"put":       (*Job).put,
+	"get":       (*Job).get,
+	"head":      (*Job).head,
+	"delete":    (*Job).delete,
+	"list":      (*Job).list,
+	"verify":    (*Job).verify,
+	"multipart": (*Job).multipart,
+	"listwalk":  (*Job).listwalk,
+	"listdir":   (*Job).listdir,
+	"versions":  (*Job).versions,
+}
+
+func (job *Job) pickOp() string {
+	n := rand.Intn(job.mixWeights[len(job.mixWeights)-1])
+	for i, w := range job.mixWeights {
+		if n < w {
+			return job.mixOps[i]
+		}
+	}
+
+	return job.mixOps[len(job.mixOps)-1]
+}
+
+// mixed runs one operation of the mix against the job's keyspace. Reads and
+// deletes fall back to a put while the keyspace is still empty.
+func (job *Job) mixed() Result {
+	name := job.pickOp()
+	key, ok := "", false
+	switch name {
+	case "put", "multipart":
+		key, ok = job.keys.New(), true
+	case "delete":
+		key, ok = job.keys.Take()
+	default:
+		key, ok = job.keys.Pick()
+	}
+
+	if !ok {
+		name = "put"
+		key = job.keys.New()
+	}
+
+	r := operations[name](job, key)
+	switch name {
+	case "put", "multipart":
+		if r.Err == "ok" {
+			job.keys.Add(key)
+		}
+	case "delete":
+		if r.Err != "ok" {
+			job.keys.Add(key)
+		}
+	}
+
+	return r
+}
+
+func (job *Job) put(filename string) Result {
+	t := time.Now()
+	o := NewObjectInputStream(job.sizes.Size(), payloadSeed(job.Seed, job.Bucket, filename), job.payload)
+	bucket := job.Bucket
+	var metadata map[string]*string
+	if job.Checksum {
+		metadata = map[string]*string{
+			"objectbench-seed":    aws.String(strconv.FormatInt(job.Seed, 10)),
+			"objectbench-payload": aws.String(o.Payload.String()),
+			"objectbench-crc64":   aws.String(strconv.FormatUint(o.Payload.Checksum(o.Seed, o.Size), 16)),
+		}
+	}
+
+	// http://docs.aws.amazon.com/sdk-for-go/api/service/s3/s3manager/#NewUploader
+	uploader := s3manager.NewUploader(job.sess, func(u *s3manager.Uploader) {
+		u.Concurrency = job.Concurrency
+		u.LeavePartsOnError = job.Delparts
+		if job.Maxparts > 0 {
+			u.MaxUploadParts = job.Maxparts
+			u.PartSize = job.psize
+		} else {
+			if job.psize > 0 {
+				u.PartSize = job.psize
+			}
+		}
+	})
+
+	// Upload the file's body to S3 bucket as an object with the key being the
+	// same as the filename.
+	algorithm, key := job.customerKey(filename)
+	_, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(filename),
+
+		// The file to be uploaded. io.ReadSeeker is preferred as the Uploader
+		// will be able to optimize memory when uploading large content. io.Reader
+		// is supported, but will require buffering of the reader's bytes for
+		// each part.
+		Body:                 o,
+		Metadata:             job.metadata(metadata),
+		ServerSideEncryption: job.serverSideEncryption(),
+		SSEKMSKeyId:          optional(job.KmsKeyId),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+		StorageClass:         optional(job.StorageClass),
+		ACL:                  optional(job.ACL),
+		ContentType:          optional(job.ContentType),
+		Tagging:              optional(job.Tagging),
+	})
+
+	if err != nil {
+		return job.failed("put", filename, t, err, fmt.Sprintf("Unable to upload %q to %q, %v", filename, bucket, err))
+	}
+
+	// An empty object is never read, the whole request is the upload.
+	if o.StartTs.IsZero() {
+		o.StartTs = t
+		o.CurrentTs = t
+	}
+
+	now := time.Now()
+	ptime := (o.CurrentTs.Sub(o.StartTs).Seconds())
+	utime := (now.Sub(o.StartTs).Seconds())
+	rate := int64((float64(o.Pos)) / utime)
+	latency := o.StartTs.Sub(t).Seconds() * 1000
+	return Result{
+		Err:          "ok",
+		Bucket:       job.Bucket,
+		Object:       filename,
+		ObjectSize:   bytesToUnits(o.Size),
+		Bytes:        o.Size,
+		Latency:      fmt.Sprintf("%vms", latency),
+		ProcessTime:  fmt.Sprintf("%vs", ptime),
+		UploadTime:   fmt.Sprintf("%vs", utime),
+		TransferRate: fmt.Sprintf("%s/s", bytesToUnits(rate)),
+		StartTime:    t.UnixNano(),
+		EndTime:      now.UnixNano(),
+		Operation:    "put",
+		LatencyNs:    o.StartTs.Sub(t).Nanoseconds(),
+		UploadNs:     now.Sub(o.StartTs).Nanoseconds(),
+	}
+}
+
+// Latency is the time to first byte for reads, ProcessTime the time from the
+// first to the last byte received.
+func (job *Job) get(filename string) Result {
+	t := time.Now()
+	o := NewObjectOutputStream()
+	bucket := job.Bucket
+	// http://docs.aws.amazon.com/sdk-for-go/api/service/s3/s3manager/#NewDownloader
+	downloader := s3manager.NewDownloader(job.sess, func(d *s3manager.Downloader) {
+		d.Concurrency = job.Concurrency
+		if job.psize > 0 {
+			d.PartSize = job.psize
+		}
+	})
+
+	algorithm, key := job.customerKey(filename)
+	_, err := downloader.Download(o, &s3.GetObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(filename),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+	})
+
+	if err != nil {
+		return job.failed("get", filename, t, err, fmt.Sprintf("Unable to download %q from %q, %v", filename, bucket, err))
+	}
+
+	if o.FirstByte {
+		o.StartTs = time.Now()
+		o.CurrentTs = o.StartTs
+	}
+
+	now := time.Now()
+	ptime := (o.CurrentTs.Sub(o.StartTs).Seconds())
+	utime := (now.Sub(t).Seconds())
+	rate := int64((float64(o.Size)) / utime)
+	latency := o.StartTs.Sub(t).Seconds() * 1000
+	return Result{
+		Err:          "ok",
+		Bucket:       job.Bucket,
+		Object:       filename,
+		ObjectSize:   bytesToUnits(o.Size),
+		Bytes:        o.Size,
+		Latency:      fmt.Sprintf("%vms", latency),
+		ProcessTime:  fmt.Sprintf("%vs", ptime),
+		UploadTime:   fmt.Sprintf("%vs", utime),
+		TransferRate: fmt.Sprintf("%s/s", bytesToUnits(rate)),
+		StartTime:    t.UnixNano(),
+		EndTime:      now.UnixNano(),
+		Operation:    "get",
+		LatencyNs:    o.StartTs.Sub(t).Nanoseconds(),
+		UploadNs:     now.Sub(t).Nanoseconds(),
+	}
+}
+
+func (job *Job) head(filename string) Result {
+	t := time.Now()
+	algorithm, key := job.customerKey(filename)
+	out, err := job.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket:               aws.String(job.Bucket),
+		Key:                  aws.String(filename),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+	})
+
+	if err != nil {
+		return job.failed("head", filename, t, err, fmt.Sprintf("Unable to head %q in %q, %v", filename, job.Bucket, err))
+	}
+
+	return job.request("head", filename, bytesToUnits(aws.Int64Value(out.ContentLength)), t)
+}
+
+func (job *Job) delete(filename string) Result {
+	t := time.Now()
+	_, err := job.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(job.Bucket),
+		Key:    aws.String(filename),
+	})
+
+	if err != nil {
+		return job.failed("delete", filename, t, err, fmt.Sprintf("Unable to delete %q from %q, %v", filename, job.Bucket, err))
+	}
+
+	return job.request("delete", filename, "", t)
+}
+
+// Every list request fetches one page of keys following filename, so workers
+// walk different parts of the prefix.
+func (job *Job) list(filename string) Result {
+	t := time.Now()
+	out, err := job.svc.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:     aws.String(job.Bucket),
+		Prefix:     aws.String(job.Keyprefix),
+		StartAfter: aws.String(filename),
+	})
+
+	if err != nil {
+		return job.failed("list", filename, t, err, fmt.Sprintf("Unable to list %q in %q, %v", job.Keyprefix, job.Bucket, err))
+	}
+
+	r := job.request("list", filename, fmt.Sprintf("%dkeys", aws.Int64Value(out.KeyCount)), t)
+	r.Keys = aws.Int64Value(out.KeyCount)
+	return r
+}
+
+// verify reads the object back and compares every byte with the payload the
+// put generated. The seed and checksum stored by a put with checksum enabled
+// take precedence over the job's seed and payload settings.
+func (job *Job) verify(filename string) Result {
+	t := time.Now()
+	algorithm, key := job.customerKey(filename)
+	out, err := job.svc.GetObject(&s3.GetObjectInput{
+		Bucket:               aws.String(job.Bucket),
+		Key:                  aws.String(filename),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+	})
+
+	if err != nil {
+		return job.failed("verify", filename, t, err, fmt.Sprintf("Unable to download %q from %q, %v", filename, job.Bucket, err))
+	}
+	defer out.Body.Close()
+
+	seed := payloadSeed(job.Seed, job.Bucket, filename)
+	if s, ok := out.Metadata["Objectbench-Seed"]; ok {
+		if v, err := strconv.ParseInt(aws.StringValue(s), 10, 64); err == nil {
+			seed = payloadSeed(v, job.Bucket, filename)
+		}
+	}
+
+	payload := job.payload
+	if s, ok := out.Metadata["Objectbench-Payload"]; ok {
+		if p, err := parsePayload(aws.StringValue(s)); err == nil {
+			payload = p
+		}
+	}
+
+	var first time.Time
+	var pos int64
+	bad := int64(-1)
+	b, e := buffers.Get().(*[]byte), buffers.Get().(*[]byte)
+	defer buffers.Put(b)
+	defer buffers.Put(e)
+	buffer, expected := *b, *e
+	crc := crc64.New(crcTable)
+	for {
+		n, rerr := out.Body.Read(buffer)
+		if n > 0 {
+			if first.IsZero() {
+				first = time.Now()
+			}
+
+			payload.Fill(seed, pos, expected[:n])
+			if bad < 0 {
+				for i := 0; i < n; i++ {
+					if buffer[i] != expected[i] {
+						bad = pos + int64(i)
+						break
+					}
+				}
+			}
+
+			crc.Write(buffer[:n])
+			pos += int64(n)
+		}
+
+		if rerr == io.EOF {
+			break
+		}
+
+		if rerr != nil {
+			return job.failed("verify", filename, t, rerr, fmt.Sprintf("Unable to download %q from %q, %v", filename, job.Bucket, rerr))
+		}
+	}
+
+	var mismatch string
+	if bad >= 0 {
+		mismatch = fmt.Sprintf("first bad byte at offset %d", bad)
+	} else if size, ok := job.sizes.(fixedSize); ok && size > 0 && pos != int64(size) {
+		mismatch = fmt.Sprintf("size %d, expected %d", pos, size)
+	} else if s, ok := out.Metadata["Objectbench-Crc64"]; ok && aws.StringValue(s) != strconv.FormatUint(crc.Sum64(), 16) {
+		mismatch = fmt.Sprintf("crc64 %x, stored %s", crc.Sum64(), aws.StringValue(s))
+	}
+
+	if mismatch != "" {
+		return job.failed("verify", filename, t, errVerify, fmt.Sprintf("Verify of %q in %q failed, %s", filename, job.Bucket, mismatch))
+	}
+
+	if first.IsZero() {
+		first = time.Now()
+	}
+
+	now := time.Now()
+	utime := now.Sub(t).Seconds()
+	return Result{
+		Err:          "ok",
+		Bucket:       job.Bucket,
+		Object:       filename,
+		ObjectSize:   bytesToUnits(pos),
+		Bytes:        pos,
+		Latency:      fmt.Sprintf("%vms", first.Sub(t).Seconds()*1000),
+		ProcessTime:  fmt.Sprintf("%vs", now.Sub(first).Seconds()),
+		UploadTime:   fmt.Sprintf("%vs", utime),
+		TransferRate: fmt.Sprintf("%s/s", bytesToUnits(int64(float64(pos)/utime))),
+		StartTime:    t.UnixNano(),
+		EndTime:      now.UnixNano(),
+		Operation:    "verify",
+		LatencyNs:    first.Sub(t).Nanoseconds(),
+		UploadNs:     now.Sub(t).Nanoseconds(),
+	}
+}
+
+func (job *Job) request(op string, filename string, size string, t time.Time) Result {
+	now := time.Now()
+	rtime := now.Sub(t).Seconds()
+	return Result{
+		Err:         "ok",
+		Bucket:      job.Bucket,
+		Object:      filename,
+		ObjectSize:  size,
+		Latency:     fmt.Sprintf("%vms", rtime*1000),
+		ProcessTime: fmt.Sprintf("%vs", rtime),
+		UploadTime:  fmt.Sprintf("%vs", rtime),
+		StartTime:   t.UnixNano(),
+		EndTime:     now.UnixNano(),
+		Operation:   op,
+		LatencyNs:   now.Sub(t).Nanoseconds(),
+		UploadNs:    now.Sub(t).Nanoseconds(),
+	}
+}
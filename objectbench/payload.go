@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc64"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync"
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+const (
+	ringSize     = 4 << 20
+	maxBlockSize = 1 << 20
+)
+
+// ring holds the random data every payload is copied from. It is generated
+// from a fixed seed, so every objectbench fills the same payloads.
+var ring = func() []byte {
+	r := make([]byte, ringSize+maxBlockSize)
+	for i := 0; i < len(r); i += 8 {
+		binary.LittleEndian.PutUint64(r[i:], splitmix(uint64(i/8)))
+	}
+
+	return r
+}()
+
+// buffers of 1M for reading and regenerating payloads.
+var buffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 1<<20)
+		return &b
+	},
+}
+
+// A Payload fills objects block by block. A block is a copy of a stretch of
+// the ring picked by the stamp of the block, derived from the seed of the
+// object and the number of the block, and every word of the copy is xored
+// with that stamp. Blocks copied from overlapping stretches of the ring so
+// share no data a store could dedupe or compress. Only the first
+// block/compressibility bytes of a block are random, the rest is zero. With
+// dedupe the given fraction of blocks repeat an earlier block of the object.
+type Payload struct {
+	compressibility float64
+	dedupe          float64
+	block           int64
+	random          int64
+	repeat          uint64
+}
+
+var randomPayload = NewPayload(1, 0, 4096)
+
+func NewPayload(compressibility float64, dedupe float64, block int64) *Payload {
+	p := &Payload{compressibility: compressibility, dedupe: dedupe, block: block, random: block}
+	if compressibility > 1 {
+		p.random = int64(float64(block) / compressibility)
+	}
+
+	if dedupe > 0 {
+		p.repeat = uint64(math.Ldexp(dedupe, 64))
+	}
+
+	return p
+}
+
+// String is stored with the seed of an object, verify generates the payload
+// of parsePayload(String()) again.
+func (p *Payload) String() string {
+	return fmt.Sprintf("%g:%g:%d", p.compressibility, p.dedupe, p.block)
+}
+
+func parsePayload(s string) (*Payload, error) {
+	var compressibility, dedupe float64
+	var block int64
+	if _, err := fmt.Sscanf(s, "%g:%g:%d", &compressibility, &dedupe, &block); err != nil {
+		return nil, err
+	}
+
+	if block < 16 || block > maxBlockSize || dedupe < 0 || dedupe >= 1 {
+		return nil, fmt.Errorf("Invalid payload %q", s)
+	}
+
+	return NewPayload(compressibility, dedupe, block), nil
+}
+
+// payloadSeed derives the seed of an object's payload from the job seed, the
+// bucket and the key, so that the same object can be generated again later.
+func payloadSeed(seed int64, bucket string, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(bucket))
+	h.Write([]byte{'/'})
+	h.Write([]byte(key))
+	return h.Sum64() ^ uint64(seed)
+}
+
+func splitmix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// source returns the block whose data a block repeats, or the block itself.
+// Block 0 is never a repeat.
+func (p *Payload) source(seed uint64, block int64) int64 {
+	for block > 0 {
+		h := splitmix(seed ^ splitmix(uint64(block)))
+		if h >= p.repeat {
+			return block
+		}
+
+		block = int64(splitmix(h) % uint64(block))
+	}
+
+	return 0
+}
+
+// Fill writes the payload bytes of the object with the given seed starting at
+// offset off into b. Any range of the object can be generated on its own.
+func (p *Payload) Fill(seed uint64, off int64, b []byte) {
+	for len(b) > 0 {
+		in := off % p.block
+		n := p.block - in
+		if n > int64(len(b)) {
+			n = int64(len(b))
+		}
+
+		p.fillBlock(splitmix(seed+uint64(p.source(seed, off/p.block))), in, b[:n])
+		b = b[n:]
+		off += n
+	}
+}
+
+// fillBlock writes bytes in to in+len(b) of the block with the given stamp.
+func (p *Payload) fillBlock(stamp uint64, in int64, b []byte) {
+	random := min64(in+int64(len(b)), p.random)
+	i := in
+	if i < random {
+		start := int64(stamp%ringSize) &^ 7
+		copy(b, ring[start+i:start+random])
+		var s [8]byte
+		binary.LittleEndian.PutUint64(s[:], stamp)
+		for ; i < random && i%8 != 0; i++ {
+			b[i-in] ^= s[i%8]
+		}
+
+		// Four words at a time, the compiler checks the bounds once.
+		for ; i+32 <= random; i += 32 {
+			w := b[i-in : i-in+32]
+			binary.LittleEndian.PutUint64(w[0:], binary.LittleEndian.Uint64(w[0:])^stamp)
+			binary.LittleEndian.PutUint64(w[8:], binary.LittleEndian.Uint64(w[8:])^stamp)
+			binary.LittleEndian.PutUint64(w[16:], binary.LittleEndian.Uint64(w[16:])^stamp)
+			binary.LittleEndian.PutUint64(w[24:], binary.LittleEndian.Uint64(w[24:])^stamp)
+		}
+
+		for ; i+8 <= random; i += 8 {
+			w := b[i-in : i-in+8]
+			binary.LittleEndian.PutUint64(w, binary.LittleEndian.Uint64(w)^stamp)
+		}
+
+		for ; i < random; i++ {
+			b[i-in] ^= s[i%8]
+		}
+	}
+
+	zero := b[i-in:]
+	for j := range zero {
+		zero[j] = 0
+	}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func (p *Payload) Checksum(seed uint64, size int64) uint64 {
+	buffer := buffers.Get().(*[]byte)
+	defer buffers.Put(buffer)
+	crc := crc64.New(crcTable)
+	for pos := int64(0); pos < size; {
+		n := int64(len(*buffer))
+		if n > size-pos {
+			n = size - pos
+		}
+
+		p.Fill(seed, pos, (*buffer)[:n])
+		crc.Write((*buffer)[:n])
+		pos += n
+	}
+
+	return crc.Sum64()
+}
+
+// payloadReader reads the payload of an object at any offset, the parts of a
+// multipart upload are sections of it.
+type payloadReader struct {
+	payload *Payload
+	seed    uint64
+	size    int64
+}
+
+func (p payloadReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off >= p.size {
+		return 0, io.EOF
+	}
+
+	if int64(len(b)) > p.size-off {
+		b = b[:p.size-off]
+		err = io.EOF
+	}
+
+	p.payload.Fill(p.seed, off, b)
+	return len(b), err
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+var payloads = []struct {
+	name    string
+	payload *Payload
+}{
+	{"random", randomPayload},
+	{"compressibility=2", NewPayload(2, 0, 4096)},
+	{"compressibility=4", NewPayload(4, 0, 4096)},
+	{"dedupe=0.5", NewPayload(1, 0.5, 4096)},
+	{"compressibility=2,dedupe=0.3", NewPayload(2, 0.3, 4096)},
+}
+
+// ratios measures the deflate ratio of 16M of the payload and the fraction of
+// its blocks that repeat an earlier one.
+func (p *Payload) ratios() (compression float64, repeated float64) {
+	data := make([]byte, 16<<20)
+	p.Fill(1, 0, data)
+	var compressed countWriter
+	w, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	w.Write(data)
+	w.Close()
+
+	seen := make(map[uint64]bool)
+	blocks := 0
+	for off := int64(0); off < int64(len(data)); off += p.block {
+		h := fnv.New64a()
+		h.Write(data[off:min64(off+p.block, int64(len(data)))])
+		if seen[h.Sum64()] {
+			repeated++
+		}
+
+		seen[h.Sum64()] = true
+		blocks++
+	}
+
+	return float64(len(data)) / float64(compressed), repeated / float64(blocks)
+}
+
+type countWriter int64
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	*c += countWriter(len(b))
+	return len(b), nil
+}
+
+func TestPayloadRatios(t *testing.T) {
+	for _, c := range []struct {
+		payload     *Payload
+		compression float64
+		repeated    float64
+	}{
+		{randomPayload, 1, 0},
+		{NewPayload(2, 0, 4096), 2, 0},
+		{NewPayload(4, 0, 4096), 4, 0},
+		{NewPayload(1, 0.5, 4096), 2, 0.5},
+		{NewPayload(1, 0, 16), 1, 0},
+	} {
+		compression, repeated := c.payload.ratios()
+		if math.Abs(repeated-c.repeated) > 0.05 {
+			t.Errorf("%s: %.3f of the blocks repeat, expected %.3f", c.payload, repeated, c.repeated)
+		}
+
+		// deflate finds the repeated blocks within its 32K window only.
+		if c.repeated == 0 && math.Abs(compression-c.compression)/c.compression > 0.1 {
+			t.Errorf("%s: compresses %.2f:1, expected %.2f:1", c.payload, compression, c.compression)
+		}
+	}
+}
+
+// Any range of an object is the same as that range of the whole object.
+func TestPayloadFill(t *testing.T) {
+	for _, c := range payloads {
+		whole := make([]byte, 64<<10+13)
+		c.payload.Fill(42, 0, whole)
+		for i := 0; i < 200; i++ {
+			off := rand.Intn(len(whole))
+			part := make([]byte, rand.Intn(len(whole)-off+1))
+			c.payload.Fill(42, int64(off), part)
+			if !bytes.Equal(part, whole[off:off+len(part)]) {
+				t.Fatalf("%s: %d bytes at %d differ from the whole object", c.name, len(part), off)
+			}
+		}
+
+		other := make([]byte, len(whole))
+		c.payload.Fill(43, 0, other)
+		if bytes.Equal(whole[:4096], other[:4096]) {
+			t.Errorf("%s: objects with different seeds start alike", c.name)
+		}
+	}
+}
+
+// Blocks copied from overlapping stretches of the ring share no word, the
+// second block starts 64 bytes into the stretch of the first.
+func TestPayloadOverlap(t *testing.T) {
+	a := make([]byte, 4096)
+	b := make([]byte, 4096)
+	stamp := uint64(12345 * ringSize)
+	randomPayload.fillBlock(stamp, 0, a)
+	randomPayload.fillBlock(stamp+64, 0, b)
+	words := make(map[uint64]bool)
+	for i := 0; i < len(a); i += 8 {
+		words[binary.LittleEndian.Uint64(a[i:])] = true
+	}
+
+	for i := 0; i < len(b); i += 8 {
+		if words[binary.LittleEndian.Uint64(b[i:])] {
+			t.Fatalf("word %d of the second block is in the first", i/8)
+		}
+	}
+}
+
+func TestParsePayload(t *testing.T) {
+	p, err := parsePayload(NewPayload(2.5, 0.25, 8192).String())
+	if err != nil || p.compressibility != 2.5 || p.dedupe != 0.25 || p.block != 8192 {
+		t.Errorf("got %v %v", p, err)
+	}
+
+	for _, s := range []string{"", "1:0", "1:1:4096", "1:0:8", "1:0:2097152", "1:-0.5:4096"} {
+		if _, err := parsePayload(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+// BenchmarkPayloadRead measures what generating a payload costs per byte.
+// Random data is a copy of the ring with the stamp of its block xored in,
+// about 5 GB/s on one core, the zeros of compressible data are cheaper.
+func BenchmarkPayloadRead(b *testing.B) {
+	for _, c := range payloads {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(1 << 20)
+			b.ReportAllocs()
+			o := NewObjectInputStream(int64(b.N)<<20, 1, c.payload)
+			buffer := make([]byte, 1<<20)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				o.Read(buffer)
+			}
+		})
+	}
+}
+
+func BenchmarkPayloadReadParallel(b *testing.B) {
+	for _, c := range payloads {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(1 << 20)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				o := NewObjectInputStream(math.MaxInt64, 1, c.payload)
+				buffer := make([]byte, 1<<20)
+				for pb.Next() {
+					o.Read(buffer)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportOp collects the results of one operation of a results file.
+type ReportOp struct {
+	Latency *Histogram
+	Ops     int64
+	Errors  int64
+	Bytes   int64
+}
+
+// ReportJob is one results file, written by one job or merged by a
+// controller.
+type ReportJob struct {
+	Name     string
+	Bucket   string
+	Target   string
+	Start    int64
+	End      int64
+	Ops      map[string]*ReportOp
+	Errors   map[string]int64
+	Messages map[string]string
+	Seconds  map[int64]*OpCounter
+}
+
+// loadResults reads a results csv. Files written before the operation column
+// was added only contain puts.
+func loadResults(path string) (*ReportJob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	job := &ReportJob{
+		Name:     strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Ops:      make(map[string]*ReportOp),
+		Errors:   make(map[string]int64),
+		Messages: make(map[string]string),
+		Seconds:  make(map[int64]*OpCounter),
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 10 {
+			return nil, fmt.Errorf("%s:%d: expected at least 10 columns, got %d", path, line, len(record))
+		}
+
+		field := func(i int) string {
+			if i < len(record) {
+				return record[i]
+			}
+
+			return ""
+		}
+
+		start, _ := strconv.ParseInt(record[8], 10, 64)
+		end, err := strconv.ParseInt(record[9], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid endtime %q", path, line, record[9])
+		}
+
+		op := field(10)
+		if op == "" {
+			op = "put"
+		}
+
+		bytes, _ := strconv.ParseInt(field(12), 10, 64)
+		if job.Bucket == "" {
+			job.Bucket = record[1]
+			job.Target = field(14)
+		}
+
+		o, ok := job.Ops[op]
+		if !ok {
+			o = &ReportOp{Latency: NewHistogram()}
+			job.Ops[op] = o
+		}
+
+		// Older files have no times for errors, they count but are not
+		// placed in time.
+		c := &OpCounter{}
+		if end > 0 {
+			if start == 0 {
+				start = end
+			}
+
+			if job.Start == 0 || start < job.Start {
+				job.Start = start
+			}
+
+			if end > job.End {
+				job.End = end
+			}
+
+			second := end / int64(time.Second)
+			if c, ok = job.Seconds[second]; !ok {
+				c = &OpCounter{}
+				job.Seconds[second] = c
+			}
+		}
+
+		if record[0] != "ok" {
+			class := field(13)
+			if class == "" {
+				class = "Other"
+			}
+
+			o.Errors++
+			c.Errors++
+			job.Errors[op+","+class]++
+			if _, ok := job.Messages[op+","+class]; !ok {
+				job.Messages[op+","+class] = record[0]
+			}
+
+			continue
+		}
+
+		ms, err := strconv.ParseFloat(strings.TrimSuffix(record[4], "ms"), 64)
+		if err == nil {
+			o.Latency.Record(int64(ms * 1000))
+		}
+
+		o.Ops++
+		o.Bytes += bytes
+		c.Ops++
+		c.Bytes += bytes
+	}
+
+	return job, nil
+}
+
+func (job *ReportJob) elapsed() float64 {
+	return float64(job.End-job.Start) / float64(time.Second)
+}
+
+func (job *ReportJob) opNames() []string {
+	names := make([]string, 0, len(job.Ops))
+	for op := range job.Ops {
+		names = append(names, op)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// series returns the ops and bytes of every second of the job, seconds
+// without results count as 0.
+func (job *ReportJob) series() (ops []float64, bytes []float64) {
+	if len(job.Seconds) == 0 {
+		return nil, nil
+	}
+
+	first, last := int64(-1), int64(0)
+	for s := range job.Seconds {
+		if first < 0 || s < first {
+			first = s
+		}
+
+		if s > last {
+			last = s
+		}
+	}
+
+	for s := first; s <= last; s++ {
+		c, ok := job.Seconds[s]
+		if !ok {
+			c = &OpCounter{}
+		}
+
+		ops = append(ops, float64(c.Ops))
+		bytes = append(bytes, float64(c.Bytes))
+	}
+
+	return ops, bytes
+}
+
+// latencyCounts splits the latencies of an operation into the buckets of the
+// Prometheus histogram, the last count is above the highest bound.
+func latencyCounts(h *Histogram) []int64 {
+	counts := make([]int64, len(latencyBuckets)+1)
+	below := int64(0)
+	for i, le := range latencyBuckets {
+		n := h.CountBelow(int64(le * 1000000))
+		counts[i] = n - below
+		below = n
+	}
+
+	counts[len(latencyBuckets)] = h.Count() - below
+	return counts
+}
+
+func latencyLabel(i int) string {
+	if i == len(latencyBuckets) {
+		return fmt.Sprintf(">%gs", latencyBuckets[i-1])
+	}
+
+	return fmt.Sprintf("<=%gs", latencyBuckets[i])
+}
+
+type reportRow struct {
+	job   *ReportJob
+	op    string
+	stats *ReportOp
+}
+
+func reportRows(jobs []*ReportJob) []reportRow {
+	var rows []reportRow
+	for _, job := range jobs {
+		for _, op := range job.opNames() {
+			rows = append(rows, reportRow{job, op, job.Ops[op]})
+		}
+	}
+
+	return rows
+}
+
+func (r reportRow) cells() []string {
+	elapsed := r.job.elapsed()
+	rate := func(v int64) float64 {
+		if elapsed <= 0 {
+			return 0
+		}
+
+		return float64(v) / elapsed
+	}
+
+	throughput := "-"
+	if rate(r.stats.Bytes) >= 1024 {
+		throughput = bytesToUnits(int64(rate(r.stats.Bytes))) + "/s"
+	} else if r.stats.Bytes > 0 {
+		throughput = fmt.Sprintf("%.0fB/s", rate(r.stats.Bytes))
+	}
+
+	p := percentilesOf(r.stats.Latency)
+	return []string{
+		r.job.Name,
+		r.job.Target,
+		r.job.Bucket,
+		r.op,
+		strconv.FormatInt(r.stats.Ops, 10),
+		strconv.FormatInt(r.stats.Errors, 10),
+		fmt.Sprintf("%.1f", elapsed),
+		fmt.Sprintf("%.2f", rate(r.stats.Ops)),
+		throughput,
+		fmt.Sprintf("%.3f", p.P50),
+		fmt.Sprintf("%.3f", p.P90),
+		fmt.Sprintf("%.3f", p.P99),
+		fmt.Sprintf("%.3f", p.Max),
+	}
+}
+
+var reportColumns = []string{"job", "target", "bucket", "operation", "ops", "errors", "seconds", "ops/s", "throughput", "p50 ms", "p90 ms", "p99 ms", "max ms"}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func sparkline(values []float64) string {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 {
+			i = int(v / max * float64(len(sparks)-1))
+		}
+
+		b.WriteRune(sparks[i])
+	}
+
+	return b.String()
+}
+
+func writeMarkdown(w io.Writer, jobs []*ReportJob) {
+	fmt.Fprintf(w, "# objectbench report\n\nGenerated %s from %d results files.\n\n", time.Now().Format(time.RFC1123), len(jobs))
+	fmt.Fprintln(w, "## Jobs")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "| %s |\n", strings.Join(reportColumns, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(reportColumns)))
+	for _, row := range reportRows(jobs) {
+		fmt.Fprintf(w, "| %s |\n", strings.Join(row.cells(), " | "))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Throughput over time")
+	for _, job := range jobs {
+		ops, bytes := job.series()
+		fmt.Fprintf(w, "\n### %s\n\n```\nops/s   %s\nbytes/s %s\n```\n", job.Name, sparkline(ops), sparkline(bytes))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Latency histograms")
+	for _, row := range reportRows(jobs) {
+		if row.stats.Ops == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n### %s %s\n\n```\n", row.job.Name, row.op)
+		counts := latencyCounts(row.stats.Latency)
+		for i, c := range counts {
+			bar := 0
+			if row.stats.Ops > 0 {
+				bar = int(c * 50 / row.stats.Ops)
+			}
+
+			fmt.Fprintf(w, "%-8s %8d %s\n", latencyLabel(i), c, strings.Repeat("█", bar))
+		}
+
+		fmt.Fprintln(w, "```")
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Errors")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| job | operation | class | count | first message |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+	for _, job := range jobs {
+		for _, key := range sortedKeys(job.Errors) {
+			op := strings.SplitN(key, ",", 2)
+			fmt.Fprintf(w, "| %s | %s | %s | %d | %s |\n", job.Name, op[0], op[1], job.Errors[key], strings.Replace(job.Messages[key], "|", `\|`, -1))
+		}
+	}
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// svgChart draws the values as bars or as a line.
+func svgChart(w io.Writer, values []float64, labels []string, line bool) {
+	const width, height = 600.0, 160.0
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	if max == 0 {
+		max = 1
+	}
+
+	fmt.Fprintf(w, "<svg width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\">\n", width, height+20, width, height+20)
+	fmt.Fprintf(w, "<rect width=\"%g\" height=\"%g\" fill=\"#f8f8f8\"/>\n", width, height)
+	step := width / float64(len(values))
+	if line {
+		var points []string
+		for i, v := range values {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", step*(float64(i)+0.5), height-v/max*height))
+		}
+
+		fmt.Fprintf(w, "<polyline fill=\"none\" stroke=\"#3366cc\" stroke-width=\"1.5\" points=\"%s\"/>\n", strings.Join(points, " "))
+	} else {
+		for i, v := range values {
+			h := v / max * height
+			fmt.Fprintf(w, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"#3366cc\"><title>%s: %g</title></rect>\n", step*float64(i)+1, height-h, step-2, h, html.EscapeString(labels[i]), v)
+		}
+	}
+
+	fmt.Fprintf(w, "<text x=\"2\" y=\"12\" font-size=\"11\">max %g</text>\n", max)
+	if len(labels) > 0 {
+		fmt.Fprintf(w, "<text x=\"2\" y=\"%g\" font-size=\"11\">%s</text>\n", height+15, html.EscapeString(labels[0]))
+		fmt.Fprintf(w, "<text x=\"%g\" y=\"%g\" font-size=\"11\" text-anchor=\"end\">%s</text>\n", width-2, height+15, html.EscapeString(labels[len(labels)-1]))
+	}
+
+	fmt.Fprintln(w, "</svg>")
+}
+
+func writeHTML(w io.Writer, jobs []*ReportJob) {
+	fmt.Fprintln(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>objectbench report</title>")
+	fmt.Fprintln(w, "<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:3px 8px;text-align:right}td:first-child,th:first-child{text-align:left}.charts{display:flex;flex-wrap:wrap;gap:1em}</style>")
+	fmt.Fprintln(w, "</head>\n<body>")
+	fmt.Fprintf(w, "<h1>objectbench report</h1>\n<p>Generated %s from %d results files.</p>\n", html.EscapeString(time.Now().Format(time.RFC1123)), len(jobs))
+
+	fmt.Fprintln(w, "<h2>Jobs</h2>\n<table>\n<tr>")
+	for _, c := range reportColumns {
+		fmt.Fprintf(w, "<th>%s</th>", html.EscapeString(c))
+	}
+
+	fmt.Fprintln(w, "</tr>")
+	for _, row := range reportRows(jobs) {
+		fmt.Fprint(w, "<tr>")
+		for _, c := range row.cells() {
+			fmt.Fprintf(w, "<td>%s</td>", html.EscapeString(c))
+		}
+
+		fmt.Fprintln(w, "</tr>")
+	}
+
+	fmt.Fprintln(w, "</table>")
+	fmt.Fprintln(w, "<h2>Throughput over time</h2>")
+	for _, job := range jobs {
+		ops, bytes := job.series()
+		if len(ops) == 0 {
+			continue
+		}
+
+		labels := []string{"0s", fmt.Sprintf("%ds", len(ops)-1)}
+		fmt.Fprintf(w, "<h3>%s</h3>\n<div class=\"charts\">\n<div><p>ops/s</p>\n", html.EscapeString(job.Name))
+		svgChart(w, ops, labels, true)
+		fmt.Fprintln(w, "</div>\n<div><p>bytes/s</p>")
+		svgChart(w, bytes, labels, true)
+		fmt.Fprintln(w, "</div>\n</div>")
+	}
+
+	fmt.Fprintln(w, "<h2>Latency histograms</h2>\n<div class=\"charts\">")
+	for _, row := range reportRows(jobs) {
+		if row.stats.Ops == 0 {
+			continue
+		}
+
+		counts := latencyCounts(row.stats.Latency)
+		values := make([]float64, len(counts))
+		labels := make([]string, len(counts))
+		for i, c := range counts {
+			values[i] = float64(c)
+			labels[i] = latencyLabel(i)
+		}
+
+		fmt.Fprintf(w, "<div><p>%s %s</p>\n", html.EscapeString(row.job.Name), html.EscapeString(row.op))
+		svgChart(w, values, labels, false)
+		fmt.Fprintln(w, "</div>")
+	}
+
+	fmt.Fprintln(w, "</div>\n<h2>Errors</h2>\n<table>\n<tr><th>job</th><th>operation</th><th>class</th><th>count</th><th>first message</th></tr>")
+	for _, job := range jobs {
+		for _, key := range sortedKeys(job.Errors) {
+			op := strings.SplitN(key, ",", 2)
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td></tr>\n", html.EscapeString(job.Name), html.EscapeString(op[0]), html.EscapeString(op[1]), job.Errors[key], html.EscapeString(job.Messages[key]))
+		}
+	}
+
+	fmt.Fprintln(w, "</table>\n</body>\n</html>")
+}
+
+// runReport implements objectbench report [-format html|md] [-o file] <results.csv...>
+func runReport(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	format := flags.String("format", "", "html or md, default by the extension of -o or html")
+	out := flags.String("o", "", "Write the report to this file instead of stdout")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		exitErrorf("Use %s report [-format html|md] [-o file] <results.csv...>", os.Args[0])
+	}
+
+	if *format == "" {
+		*format = "html"
+		if ext := strings.ToLower(filepath.Ext(*out)); ext == ".md" || ext == ".markdown" {
+			*format = "md"
+		}
+	}
+
+	if *format != "html" && *format != "md" {
+		exitErrorf("Unknown report format %q, use html or md", *format)
+	}
+
+	var jobs []*ReportJob
+	for _, path := range flags.Args() {
+		job, err := loadResults(path)
+		if err != nil {
+			exitErrorf("Error reading results %v", err)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			exitErrorf("Error writing report %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "md" {
+		writeMarkdown(w, jobs)
+	} else {
+		writeHTML(w, jobs)
+	}
+}
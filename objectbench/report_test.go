@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A file written before the operation column, with an error without times.
+const oldResults = `ok,b,o1,1024,2.5ms,1ms,1ms,1MB/s,1500000000000000000,1500000000002500000
+NoSuchBucket: The specified bucket does not exist,b,o2,1024,0ms,0ms,0ms,0B/s,0,0
+ok,b,o3,1024,3.5ms,1ms,1ms,1MB/s,1500000002000000000,1500000002003500000
+`
+
+func TestLoadOldResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.csv")
+	if err := ioutil.WriteFile(path, []byte(oldResults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := loadResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := job.Ops["put"]
+	if len(job.Ops) != 1 || put == nil || put.Ops != 2 || put.Errors != 1 {
+		t.Errorf("ops %+v", job.Ops)
+	}
+
+	if job.Start != 1500000000000000000 || job.End != 1500000002003500000 {
+		t.Errorf("the results span %d to %d", job.Start, job.End)
+	}
+
+	if ops, _ := job.series(); len(ops) != 3 || ops[0] != 1 || ops[1] != 0 || ops[2] != 1 {
+		t.Errorf("ops per second %v", ops)
+	}
+
+	if job.Errors["put,Other"] != 1 {
+		t.Errorf("errors %v", job.Errors)
+	}
+
+	var out bytes.Buffer
+	writeMarkdown(&out, []*ReportJob{job})
+	if !strings.Contains(out.String(), "| old |  | b | put | 2 | 1 | 2.0 | 1.00 |") {
+		t.Errorf("report\n%s", out.String())
+	}
+
+	out.Reset()
+	writeHTML(&out, []*ReportJob{job})
+	if !strings.Contains(out.String(), "<td>NoSuchBucket: The specified bucket does not exist</td>") {
+		t.Errorf("report\n%s", out.String())
+	}
+}
+
+// A job with only errors has nothing to place in time.
+func TestReportErrorsOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.csv")
+	if err := ioutil.WriteFile(path, []byte("AccessDenied,b,o,1024,0ms,0ms,0ms,0B/s,0,0,put,,0,AccessDenied\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := loadResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops, _ := job.series(); len(ops) != 0 || job.elapsed() != 0 {
+		t.Errorf("%d seconds of ops, elapsed %v", len(ops), job.elapsed())
+	}
+
+	var out bytes.Buffer
+	writeMarkdown(&out, []*ReportJob{job})
+	if !strings.Contains(out.String(), "| failed | put | AccessDenied | 1 | AccessDenied |") {
+		t.Errorf("report\n%s", out.String())
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type Schedule struct {
+	TargetOps   float64     `json:"target_ops"`
+	TargetBytes int64       `json:"target_bytes"`
+	Ops         float64     `json:"ops"`
+	Lag         Percentiles `json:"lag_ms"`
+	Behind      float64     `json:"behind_ms"`
+}
+
+func (job *Job) openLoop() bool {
+	return job.RateOps > 0 || job.rateBytes > 0
+}
+
+// schedule returns when the next request is due to hold the target rate. The
+// schedule does not wait for busy workers, so a slow store shows up as lag
+// instead of silently lowering the request rate. It starts once all workers
+// ramped up, so the ramp up adds no lag.
+func (job *Job) schedule(size int64) time.Time {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.slot.IsZero() {
+		job.slot = job.scheduleStart()
+	}
+
+	intended := job.slot
+	job.slot = job.slot.Add(job.slotLength(size))
+	return intended
+}
+
+func (job *Job) scheduleStart() time.Time {
+	return job.start.Add(job.rampup)
+}
+
+// slotLength is the time between two requests of the given size.
+func (job *Job) slotLength(size int64) time.Duration {
+	var interval time.Duration
+	if job.RateOps > 0 {
+		interval = time.Duration(float64(time.Second) / job.RateOps)
+	}
+
+	if job.rateBytes > 0 {
+		b := time.Duration(float64(size) / float64(job.rateBytes) * float64(time.Second))
+		if b > interval {
+			interval = b
+		}
+	}
+
+	return interval
+}
+
+// behind is how far the requests completed at the end of the job trail the
+// schedule, the time the missing requests take at the target rate.
+func (job *Job) behind() time.Duration {
+	from := job.scheduleStart()
+	if job.measured.After(from) {
+		from = job.measured
+	}
+
+	interval := job.slotLength(int64(job.sizes.Mean()))
+	if interval <= 0 || !job.finished.After(from) {
+		return 0
+	}
+
+	missing := int64(job.finished.Sub(from)/interval) - atomic.LoadInt64(&job.done)
+	if missing <= 0 {
+		return 0
+	}
+
+	return time.Duration(missing) * interval
+}
+
+// Latency is measured from the intended start, which includes the time the
+// request waited for a free worker.
+func (r *Result) delay(intended time.Time, lag time.Duration) {
+	r.LagNs = lag.Nanoseconds()
+	if r.Err != "ok" {
+		return
+	}
+
+	r.StartTime = intended.UnixNano()
+	r.LatencyNs += r.LagNs
+	r.Latency = fmt.Sprintf("%vms", float64(r.LatencyNs)/1000000)
+}
+
+func (job *Job) scheduleSummary() *Schedule {
+	if !job.openLoop() || job.lag == nil {
+		return nil
+	}
+
+	var ops int64
+	for _, s := range job.stats {
+		ops += s.Latency.Count()
+	}
+
+	s := &Schedule{
+		TargetOps:   job.RateOps,
+		TargetBytes: job.rateBytes,
+		Lag:         percentilesOf(job.lag),
+		Behind:      float64(job.behind()) / float64(time.Millisecond),
+	}
+
+	if elapsed := job.finished.Sub(job.measured).Seconds(); elapsed > 0 {
+		s.Ops = float64(ops) / elapsed
+	}
+
+	return s
+}
+
+func printSchedule(name string, s *Schedule) {
+	fmt.Println("job,target_ops/s,target_bytes/s,ops/s,lag_p50ms,lag_p99ms,lag_maxms,behind_ms")
+	fmt.Printf("%s,%.2f,%d,%.2f,%.3f,%.3f,%.3f,%.3f\n", name, s.TargetOps, s.TargetBytes, s.Ops, s.Lag.P50, s.Lag.P99, s.Lag.Max, s.Behind)
+}
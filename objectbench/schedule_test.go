@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	start := time.Now()
+	job := &Job{RateOps: 100, start: start, rampup: 200 * time.Millisecond}
+	for i := 0; i < 3; i++ {
+		if slot := job.schedule(1024); !slot.Equal(start.Add(200*time.Millisecond + time.Duration(i)*10*time.Millisecond)) {
+			t.Errorf("slot %d at %v after the start", i, slot.Sub(start))
+		}
+	}
+
+	// The slower of both rates sets the interval.
+	job = &Job{RateOps: 100, rateBytes: 1 << 20}
+	if l := job.slotLength(1 << 20); l != time.Second {
+		t.Errorf("1M at 1M/s every %v", l)
+	}
+
+	if l := job.slotLength(1024); l != 10*time.Millisecond {
+		t.Errorf("1K at 100 ops/s every %v", l)
+	}
+}
+
+func TestBehind(t *testing.T) {
+	sizes, _ := parseSizes("1K")
+	start := time.Now()
+	for _, c := range []struct {
+		rampup   time.Duration
+		warmup   time.Duration
+		done     int64
+		expected time.Duration
+	}{
+		{0, 0, 50, 500 * time.Millisecond},
+		{0, 0, 100, 0},
+		{0, 0, 120, 0},
+		{200 * time.Millisecond, 0, 50, 300 * time.Millisecond},
+		{200 * time.Millisecond, 500 * time.Millisecond, 20, 300 * time.Millisecond},
+	} {
+		job := &Job{RateOps: 100, sizes: sizes, start: start, rampup: c.rampup, measured: start.Add(c.warmup), finished: start.Add(time.Second), done: c.done}
+		if b := job.behind(); b != c.expected {
+			t.Errorf("%+v: behind %v", c, b)
+		}
+	}
+}
+
+// Every request has a lag, its parts don't add any.
+func TestRecordLag(t *testing.T) {
+	job := &Job{RateOps: 50}
+	job.record(Result{Err: "ok", Operation: "uploadpart", part: true})
+	job.record(Result{Err: "ok", Operation: "uploadpart", part: true})
+	job.record(Result{Err: "ok", Operation: "multipart", LagNs: 5000000})
+	if job.lag.Count() != 1 || job.lag.Min() != 5000 {
+		t.Errorf("%d lags, the least %dus", job.lag.Count(), job.lag.Min())
+	}
+}
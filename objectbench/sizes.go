@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Sizer draws the size of the next object of a job. Objectsize accepts
+//
+//	4K                            every object has the same size
+//	uniform:4K-1M                 sizes uniformly distributed between 4K and 1M
+//	lognormal:mean=64K,sigma=1.5  log-normally distributed around a mean
+//	4K:50,1M:40,100M:10           a weighted list of sizes
+type Sizer interface {
+	Size() int64
+	Mean() float64
+	Max() int64
+}
+
+type fixedSize int64
+
+func (s fixedSize) Size() int64   { return int64(s) }
+func (s fixedSize) Mean() float64 { return float64(s) }
+func (s fixedSize) Max() int64    { return int64(s) }
+
+type uniformSize struct {
+	min int64
+	max int64
+}
+
+func (s uniformSize) Size() int64   { return s.min + rand.Int63n(s.max-s.min+1) }
+func (s uniformSize) Mean() float64 { return float64(s.min+s.max) / 2 }
+func (s uniformSize) Max() int64    { return s.max }
+
+// Sizes of a lognormal distribution are capped at max, or at e^(mu+4*sigma) if
+// no max is given, which leaves out fewer than 1 in 30000 objects.
+type lognormalSize struct {
+	mu    float64
+	sigma float64
+	mean  float64
+	max   int64
+}
+
+func (s lognormalSize) Size() int64 {
+	v := int64(math.Exp(s.mu + s.sigma*rand.NormFloat64()))
+	if v > s.max {
+		return s.max
+	}
+
+	return v
+}
+
+func (s lognormalSize) Mean() float64 { return s.mean }
+func (s lognormalSize) Max() int64    { return s.max }
+
+type weightedSize struct {
+	sizes   []int64
+	weights []int
+}
+
+func (s weightedSize) Size() int64 {
+	n := rand.Intn(s.weights[len(s.weights)-1])
+	for i, w := range s.weights {
+		if n < w {
+			return s.sizes[i]
+		}
+	}
+
+	return s.sizes[len(s.sizes)-1]
+}
+
+func (s weightedSize) Mean() float64 {
+	var sum float64
+	prev := 0
+	for i, w := range s.weights {
+		sum += float64(s.sizes[i]) * float64(w-prev)
+		prev = w
+	}
+
+	return sum / float64(s.weights[len(s.weights)-1])
+}
+
+func (s weightedSize) Max() int64 {
+	var max int64
+	for _, size := range s.sizes {
+		if size > max {
+			max = size
+		}
+	}
+
+	return max
+}
+
+func parseSizes(spec string) (Sizer, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case strings.HasPrefix(spec, "uniform:"):
+		bounds := strings.SplitN(strings.TrimPrefix(spec, "uniform:"), "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("Expected uniform:<min>-<max> in %q", spec)
+		}
+
+		min, err := unitsToBytes(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+
+		max, err := unitsToBytes(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if min < 0 || max < min {
+			return nil, fmt.Errorf("Invalid range in %q", spec)
+		}
+
+		return uniformSize{min: min, max: max}, nil
+	case strings.HasPrefix(spec, "lognormal:"):
+		var mean, max int64
+		var sigma float64
+		var err error
+		for _, param := range strings.Split(strings.TrimPrefix(spec, "lognormal:"), ",") {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("Expected <name>=<value> for %q in %q", param, spec)
+			}
+
+			switch strings.TrimSpace(kv[0]) {
+			case "mean":
+				mean, err = unitsToBytes(strings.TrimSpace(kv[1]))
+			case "sigma":
+				sigma, err = strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			case "max":
+				max, err = unitsToBytes(strings.TrimSpace(kv[1]))
+			default:
+				err = fmt.Errorf("Unknown parameter %q, use mean, sigma and max", kv[0])
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if mean <= 0 || sigma <= 0 {
+			return nil, fmt.Errorf("lognormal needs a mean and sigma > 0 in %q", spec)
+		}
+
+		mu := math.Log(float64(mean)) - sigma*sigma/2
+		if max == 0 {
+			max = int64(math.Exp(mu + 4*sigma))
+		}
+
+		return lognormalSize{mu: mu, sigma: sigma, mean: float64(mean), max: max}, nil
+	case strings.Contains(spec, ":"):
+		var s weightedSize
+		total := 0
+		for _, entry := range strings.Split(spec, ",") {
+			sw := strings.SplitN(entry, ":", 2)
+			if len(sw) != 2 {
+				return nil, fmt.Errorf("Expected <size>:<weight> for %q in %q", entry, spec)
+			}
+
+			size, err := unitsToBytes(strings.TrimSpace(sw[0]))
+			if err != nil {
+				return nil, err
+			}
+
+			weight, err := strconv.Atoi(strings.TrimSpace(sw[1]))
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("Invalid weight %q in %q", sw[1], spec)
+			}
+
+			total += weight
+			s.sizes = append(s.sizes, size)
+			s.weights = append(s.weights, total)
+		}
+
+		if total == 0 {
+			return nil, errors.New("The weights of the object sizes add up to 0")
+		}
+
+		return s, nil
+	}
+
+	size, err := unitsToBytes(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return fixedSize(size), nil
+}
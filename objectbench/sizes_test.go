@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseSizes(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		mean float64
+		min  int64
+		max  int64
+	}{
+		{"4K", 4096, 4096, 4096},
+		{"0", 0, 0, 0},
+		{"uniform:4K-8K", 6144, 4096, 8192},
+		{"1K:1,3K:1", 2048, 1024, 3072},
+		{"1K:3, 5K:1", 2048, 1024, 5120},
+		{"lognormal:mean=64K,sigma=1", 65536, 0, 1 << 30},
+		{"lognormal:mean=64K,sigma=1.5,max=1M", 65536, 0, 1 << 20},
+	} {
+		s, err := parseSizes(c.spec)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+
+		if s.Mean() != c.mean {
+			t.Errorf("%s: mean %v, expected %v", c.spec, s.Mean(), c.mean)
+		}
+
+		var sum float64
+		const n = 100000
+		for i := 0; i < n; i++ {
+			size := s.Size()
+			if size < c.min || size > c.max || size > s.Max() {
+				t.Fatalf("%s: size %d is out of range", c.spec, size)
+			}
+
+			sum += float64(size)
+		}
+
+		// The cap of a lognormal distribution cuts off a little of its mean.
+		if c.mean > 0 && math.Abs(sum/n-c.mean)/c.mean > 0.1 {
+			t.Errorf("%s: sizes average %v, expected %v", c.spec, sum/n, c.mean)
+		}
+	}
+}
+
+func TestParseSizesErrors(t *testing.T) {
+	for _, spec := range []string{
+		"4X",
+		"uniform:4K",
+		"uniform:8K-4K",
+		"lognormal:mean=64K",
+		"lognormal:sigma=1",
+		"lognormal:mean=64K,sigma=1,shape=2",
+		"4K:0,8K:0",
+		"4K:-1",
+		"4K:1,8K",
+	} {
+		if _, err := parseSizes(spec); err == nil {
+			t.Errorf("%q: no error", spec)
+		}
+	}
+}
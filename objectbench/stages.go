@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StageSummary totals the operations of the jobs of a stage.
+type StageSummary struct {
+	Stage   int      `json:"stage"`
+	Jobs    []string `json:"jobs"`
+	Ops     int64    `json:"ops"`
+	Errors  int64    `json:"errors"`
+	Bytes   int64    `json:"bytes"`
+	Seconds float64  `json:"seconds"`
+}
+
+// planStages resolves the after and from fields of the jobs and sets up the
+// keyspaces they share, it returns one message per invalid field.
+//
+// All jobs of a stage run in parallel and a stage starts when the one before
+// it is finished. after and from move a job to a stage after the job they
+// name, from also hands the keys that job wrote to this one:
+//
+//   - name: fill
+//     operation: put
+//     count: 1000000
+//   - operation: get
+//     from: fill
+//
+// reads back every object of fill once.
+func planStages(jobs []Job) []string {
+	var errs []string
+	fail := func(j int, field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("job %d (%s): %s: %s", j+1, jobs[j].name(), field, fmt.Sprintf(format, args...)))
+	}
+
+	names := make(map[string]int)
+	for j := range jobs {
+		if jobs[j].Stage < 0 {
+			fail(j, "stage", "negative value %d", jobs[j].Stage)
+		}
+
+		if jobs[j].Name == "" {
+			continue
+		}
+
+		if _, ok := names[jobs[j].Name]; ok {
+			fail(j, "name", "%q is used by another job", jobs[j].Name)
+		}
+
+		names[jobs[j].Name] = j
+	}
+
+	deps := make([][]int, len(jobs))
+	for j := range jobs {
+		for _, d := range []struct {
+			field string
+			name  string
+		}{
+			{"after", jobs[j].After},
+			{"from", jobs[j].From},
+		} {
+			if d.name == "" {
+				continue
+			}
+
+			i, ok := names[d.name]
+			if !ok {
+				fail(j, d.field, "no job is named %q", d.name)
+			} else if i == j {
+				fail(j, d.field, "the job cannot wait for itself")
+			} else {
+				deps[j] = append(deps[j], i)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for pass := 0; ; pass++ {
+		changed := false
+		for j := range jobs {
+			for _, i := range deps[j] {
+				if jobs[j].Stage <= jobs[i].Stage {
+					jobs[j].Stage = jobs[i].Stage + 1
+					changed = true
+					if pass == len(jobs) {
+						fail(j, "after", "the job waits for itself through %q", jobs[i].name())
+					}
+				}
+			}
+		}
+
+		if !changed {
+			break
+		}
+
+		if pass == len(jobs) {
+			return errs
+		}
+	}
+
+	for j := range jobs {
+		if jobs[j].From == "" {
+			continue
+		}
+
+		source := &jobs[names[jobs[j].From]]
+		switch {
+		case source.keys != nil:
+			source.output = source.keys
+		case source.Operation == "put" || source.Operation == "multipart":
+			if source.output == nil {
+				source.output = NewKeyspace(0, source.objectKey, 0)
+			}
+		default:
+			fail(j, "from", "job %q does not write objects", jobs[j].From)
+			continue
+		}
+
+		if source.Bucket != jobs[j].Bucket {
+			fail(j, "from", "job %q writes to bucket %s", jobs[j].From, source.Bucket)
+		}
+
+		jobs[j].input = source.output
+		if jobs[j].keys != nil {
+			jobs[j].keys = source.output
+		}
+	}
+
+	return errs
+}
+
+// stages groups the jobs by stage, with -sequential every job is a stage of
+// its own.
+func stages(jobs []Job) [][]*Job {
+	order := make([]*Job, len(jobs))
+	for j := range jobs {
+		order[j] = &jobs[j]
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return order[a].Stage < order[b].Stage
+	})
+
+	var groups [][]*Job
+	for i, job := range order {
+		if i == 0 || *sequential || job.Stage != order[i-1].Stage {
+			groups = append(groups, nil)
+		}
+
+		groups[len(groups)-1] = append(groups[len(groups)-1], job)
+	}
+
+	return groups
+}
+
+// runStage starts the jobs of a stage once the keys of the jobs they read
+// from are known and waits for them.
+func runStage(jobs []*Job) StageSummary {
+	s := StageSummary{Stage: jobs[0].Stage}
+	var ready []*Job
+	for _, job := range jobs {
+		s.Jobs = append(s.Jobs, job.name())
+		if job.input != nil {
+			n := job.input.Len()
+			if n == 0 {
+				fmt.Printf("Skipping %s, %s wrote no objects\n", job.name(), job.From)
+				continue
+			}
+
+			if job.Count == 0 && job.duration == 0 {
+				job.Count = int64(n)
+			}
+		}
+
+		ready = append(ready, job)
+	}
+
+	fmt.Printf("Stage %d: %d jobs\n", s.Stage, len(ready))
+	t := time.Now()
+	startJobs(ready)
+	s.Seconds = time.Since(t).Seconds()
+	for _, job := range ready {
+		job.statsMu.Lock()
+		for _, o := range job.stats {
+			s.Ops += o.Latency.Count()
+			s.Errors += o.Errors
+			s.Bytes += o.Bytes
+		}
+		job.statsMu.Unlock()
+	}
+
+	return s
+}
+
+func printStages(summaries []StageSummary) {
+	fmt.Println("stage,jobs,ops,errors,bytes,seconds,ops/s,bytes/s")
+	for _, s := range summaries {
+		var ops, bytes float64
+		if s.Seconds > 0 {
+			ops = float64(s.Ops) / s.Seconds
+			bytes = float64(s.Bytes) / s.Seconds
+		}
+
+		fmt.Printf("%d,%d,%d,%d,%d,%.3f,%.2f,%.0f\n", s.Stage, len(s.Jobs), s.Ops, s.Errors, s.Bytes, s.Seconds, ops, bytes)
+	}
+}
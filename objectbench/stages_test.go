@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanStages(t *testing.T) {
+	jobs := []Job{
+		{Name: "fill", Bucket: "b", Operation: "put"},
+		{Name: "read", Bucket: "b", Operation: "get", From: "fill"},
+		{Bucket: "b", Operation: "delete", After: "read"},
+		{Bucket: "b", Operation: "put", Stage: 1},
+	}
+
+	if errs := planStages(jobs); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	for j, stage := range []int{0, 1, 2, 1} {
+		if jobs[j].Stage != stage {
+			t.Errorf("job %d runs in stage %d, expected %d", j+1, jobs[j].Stage, stage)
+		}
+	}
+
+	if jobs[1].input == nil || jobs[1].input != jobs[0].output {
+		t.Errorf("read does not read the keys fill writes")
+	}
+
+	groups := stages(jobs)
+	if len(groups) != 3 || len(groups[1]) != 2 {
+		t.Errorf("%d stages", len(groups))
+	}
+}
+
+func TestPlanStagesErrors(t *testing.T) {
+	for _, c := range []struct {
+		jobs []Job
+		err  string
+	}{
+		{[]Job{{Name: "a", After: "b"}, {Name: "b", After: "a"}}, "waits for itself through"},
+		{[]Job{{Name: "a", After: "c"}, {Name: "b", After: "a"}, {Name: "c", After: "b"}}, "waits for itself through"},
+		{[]Job{{Name: "a", After: "a"}}, "cannot wait for itself"},
+		{[]Job{{Name: "a"}, {Name: "a"}}, "is used by another job"},
+		{[]Job{{After: "x"}}, `no job is named "x"`},
+		{[]Job{{Stage: -1}}, "negative value"},
+		{[]Job{{Name: "a", Operation: "get"}, {From: "a"}}, "does not write objects"},
+		{[]Job{{Name: "a", Operation: "put", Bucket: "b1"}, {From: "a", Bucket: "b2"}}, "writes to bucket b1"},
+	} {
+		errs := planStages(c.jobs)
+		if len(errs) == 0 || !strings.Contains(strings.Join(errs, "\n"), c.err) {
+			t.Errorf("%+v: got %q, expected %q", c.jobs, errs, c.err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var percentiles = flag.Bool("percentiles", false, "Print latency percentiles per job and operation every second")
+
+var running []*Job
+var started []*Job
+var runningMu sync.Mutex
+
+func setRunning(jobs []*Job) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	running = jobs
+	started = append(started, jobs...)
+}
+
+func runningJobs() []*Job {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	return running
+}
+
+// resetStarted forgets the jobs of the previous run of a service.
+func resetStarted() {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	running = nil
+	started = nil
+}
+
+// startedJobs are the jobs of the current and all earlier stages.
+func startedJobs() []*Job {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	return started
+}
+
+// OpStats keeps the latency and upload time histograms of one operation in
+// microseconds.
+type OpStats struct {
+	Latency *Histogram
+	Upload  *Histogram
+	Size    *Histogram
+	Bytes   int64
+	Keys    int64
+	Errors  int64
+}
+
+func NewOpStats() *OpStats {
+	return &OpStats{
+		Latency: NewHistogram(),
+		Upload:  NewHistogram(),
+		Size:    NewHistogram(),
+	}
+}
+
+type Percentiles struct {
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p99.9"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+func percentilesOf(h *Histogram) Percentiles {
+	return Percentiles{
+		P50:  float64(h.Quantile(0.5)) / 1000,
+		P90:  float64(h.Quantile(0.9)) / 1000,
+		P99:  float64(h.Quantile(0.99)) / 1000,
+		P999: float64(h.Quantile(0.999)) / 1000,
+		Max:  float64(h.Max()) / 1000,
+		Mean: h.Mean() / 1000,
+	}
+}
+
+// Sizes of the objects transferred in bytes.
+type SizeSummary struct {
+	Min  int64   `json:"min"`
+	P50  int64   `json:"p50"`
+	P90  int64   `json:"p90"`
+	P99  int64   `json:"p99"`
+	Max  int64   `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+type OpSummary struct {
+	Ops         int64        `json:"ops"`
+	Errors      int64        `json:"errors"`
+	Bytes       int64        `json:"bytes"`
+	OpsPerSec   float64      `json:"ops_per_sec"`
+	BytesPerSec float64      `json:"bytes_per_sec"`
+	Latency     Percentiles  `json:"latency_ms"`
+	UploadTime  Percentiles  `json:"uploadtime_ms"`
+	Size        *SizeSummary `json:"size_bytes,omitempty"`
+}
+
+type Summary struct {
+	Name       string                  `json:"name,omitempty"`
+	Stage      int                     `json:"stage"`
+	Target     string                  `json:"target,omitempty"`
+	Bucket     string                  `json:"bucket"`
+	Keyprefix  string                  `json:"keyprefix"`
+	Objectsize string                  `json:"objectsize"`
+	Operation  string                  `json:"operation"`
+	Workers    int                     `json:"workers"`
+	Operations map[string]*OpSummary   `json:"operations"`
+	Schedule   *Schedule               `json:"schedule,omitempty"`
+	Errors     map[string]int64        `json:"errors,omitempty"`
+	Uploads    *UploadCheck            `json:"uploads,omitempty"`
+	Listing    map[string]*ListSummary `json:"listing,omitempty"`
+	Cleanup    *CleanupSummary         `json:"cleanup,omitempty"`
+}
+
+func (job *Job) record(r Result) {
+	job.statsMu.Lock()
+	defer job.statsMu.Unlock()
+	if job.stats == nil {
+		job.stats = make(map[string]*OpStats)
+		job.interval = make(map[string]*OpStats)
+	}
+
+	if r.Err != "ok" && r.ErrClass != "" {
+		if job.errClasses == nil {
+			job.errClasses = make(map[string]int64)
+		}
+
+		job.errClasses[r.ErrClass]++
+	}
+
+	for _, stats := range []map[string]*OpStats{job.stats, job.interval} {
+		s, ok := stats[r.Operation]
+		if !ok {
+			s = NewOpStats()
+			stats[r.Operation] = s
+		}
+
+		if r.Err != "ok" {
+			s.Errors++
+			continue
+		}
+
+		s.Latency.Record(r.LatencyNs / 1000)
+		s.Upload.Record(r.UploadNs / 1000)
+		s.Bytes += r.Bytes
+		s.Keys += r.Keys
+		if r.Bytes > 0 {
+			s.Size.Record(r.Bytes)
+		}
+	}
+
+	// The parts of a request were not scheduled on their own.
+	if job.openLoop() && !r.part {
+		if job.lag == nil {
+			job.lag = NewHistogram()
+		}
+
+		job.lag.Record(r.LagNs / 1000)
+	}
+}
+
+func summarize(stats map[string]*OpStats) map[string]*OpSummary {
+	ops := make(map[string]*OpSummary)
+	for name, s := range stats {
+		ops[name] = &OpSummary{
+			Ops:        s.Latency.Count(),
+			Errors:     s.Errors,
+			Bytes:      s.Bytes,
+			Latency:    percentilesOf(s.Latency),
+			UploadTime: percentilesOf(s.Upload),
+		}
+
+		if s.Size.Count() > 0 {
+			ops[name].Size = &SizeSummary{
+				Min:  s.Size.Min(),
+				P50:  s.Size.Quantile(0.5),
+				P90:  s.Size.Quantile(0.9),
+				P99:  s.Size.Quantile(0.99),
+				Max:  s.Size.Max(),
+				Mean: s.Size.Mean(),
+			}
+		}
+	}
+
+	return ops
+}
+
+func printSummaries(name string, ops map[string]*OpSummary) {
+	names := make([]string, 0, len(ops))
+	for op := range ops {
+		names = append(names, op)
+	}
+
+	sort.Strings(names)
+	for _, op := range names {
+		s := ops[op]
+		for _, m := range []struct {
+			metric string
+			p      Percentiles
+		}{{"latency", s.Latency}, {"uploadtime", s.UploadTime}} {
+			fmt.Printf("%s,%s,%s,%d,%d,%.3f,%.3f,%.3f,%.3f,%.3f\n", name, op, m.metric, s.Ops, s.Errors, m.p.P50, m.p.P90, m.p.P99, m.p.P999, m.p.Max)
+		}
+	}
+}
+
+func printSizes(name string, ops map[string]*OpSummary) {
+	names := make([]string, 0, len(ops))
+	for op := range ops {
+		if ops[op].Size != nil {
+			names = append(names, op)
+		}
+	}
+
+	if len(names) == 0 {
+		return
+	}
+
+	sort.Strings(names)
+	fmt.Println("job,operation,min,p50,p90,p99,max,mean")
+	for _, op := range names {
+		s := ops[op].Size
+		fmt.Printf("%s,%s,%s,%s,%s,%s,%s,%s\n", name, op, bytesToUnits(s.Min), bytesToUnits(s.P50), bytesToUnits(s.P90), bytesToUnits(s.P99), bytesToUnits(s.Max), bytesToUnits(int64(s.Mean)))
+	}
+}
+
+func (job *Job) name() string {
+	if job.Name != "" {
+		return job.Name
+	}
+
+	if job.Target != "" {
+		return job.Target + ":" + job.Bucket + "/" + job.Keyprefix
+	}
+
+	return job.Bucket + "/" + job.Keyprefix
+}
+
+func (job *Job) printInterval() {
+	job.statsMu.Lock()
+	ops := summarize(job.interval)
+	job.interval = make(map[string]*OpStats)
+	job.statsMu.Unlock()
+	printSummaries(job.name(), ops)
+}
+
+func (job *Job) summary() Summary {
+	job.statsMu.Lock()
+	defer job.statsMu.Unlock()
+	ops := summarize(job.stats)
+	if elapsed := job.finished.Sub(job.measured).Seconds(); elapsed > 0 {
+		for _, s := range ops {
+			s.OpsPerSec = float64(s.Ops) / elapsed
+			s.BytesPerSec = float64(s.Bytes) / elapsed
+		}
+	}
+
+	return Summary{
+		Name:       job.Name,
+		Stage:      job.Stage,
+		Target:     job.Target,
+		Bucket:     job.Bucket,
+		Keyprefix:  job.Keyprefix,
+		Objectsize: job.Objectsize,
+		Operation:  job.Operation,
+		Workers:    job.Workers,
+		Operations: ops,
+		Schedule:   job.scheduleSummary(),
+		Errors:     job.errClasses,
+		Uploads:    job.uploadCheck,
+		Listing:    summarizeListing(job.stats, job.finished.Sub(job.measured)),
+		Cleanup:    job.cleanupSummary,
+	}
+}
+
+// The summary is written next to the results as <results>_summary.json.
+func (job *Job) summaryPath() string {
+	if job.Results == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(job.Results, filepath.Ext(job.Results)) + "_summary.json"
+}
+
+func (job *Job) writeSummary() {
+	s := job.summary()
+	fmt.Println("job,operation,metric,ops,errors,p50ms,p90ms,p99ms,p99.9ms,maxms")
+	printSummaries(job.name(), s.Operations)
+	printSizes(job.name(), s.Operations)
+	printErrorClasses(job.name(), s.Errors)
+	if s.Schedule != nil {
+		printSchedule(job.name(), s.Schedule)
+	}
+
+	if s.Listing != nil {
+		printListing(job.name(), s.Listing)
+	}
+
+	if s.Uploads != nil {
+		printUploadCheck(job.name(), s.Uploads)
+	}
+
+	if s.Cleanup != nil {
+		printCleanup(job.name(), s.Cleanup)
+	}
+
+	path := job.summaryPath()
+	if path == "" {
+		return
+	}
+
+	raw, err := json.MarshalIndent(s, "", "    ")
+	if err == nil {
+		err = ioutil.WriteFile(path, raw, 0644)
+	}
+
+	if err != nil {
+		fmt.Printf("Error writing %s: %v\n", path, err)
+	}
+}
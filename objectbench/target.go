@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// session returns the session for the job's target. The endpoint, region,
+// profile, keys and signing settings of a job override the command line
+// flags, so one run can compare two clusters side by side. Jobs with the same
+// settings share a session.
+func (job *Job) session(sessions map[string]*session.Session) (*session.Session, error) {
+	endpoint, region, profile := *endpoint, *region, *profile
+	pathstyle, nossl, nomd5, nosum, retries := *pathstyle, *nossl, *nomd5, *nosum, *retries
+	if job.Endpoint != "" {
+		endpoint = job.Endpoint
+	}
+
+	if job.Region != "" {
+		region = job.Region
+	}
+
+	if job.Profile != "" {
+		profile = job.Profile
+	}
+
+	if job.Pathstyle != nil {
+		pathstyle = *job.Pathstyle
+	}
+
+	if job.Nossl != nil {
+		nossl = *job.Nossl
+	}
+
+	if job.Nomd5 != nil {
+		nomd5 = *job.Nomd5
+	}
+
+	if job.Nosum != nil {
+		nosum = *job.Nosum
+	}
+
+	if job.Retries != nil {
+		retries = *job.Retries
+	}
+
+	if job.Target == "" && job.Endpoint != "" {
+		job.Target = job.Endpoint
+	}
+
+	id := fmt.Sprintf("%s|%s|%s|%s|%s|%v|%v|%v|%v|%v|%d", endpoint, region, profile, job.AccessKey, job.SecretKey, job.Anonymous, pathstyle, nossl, nomd5, nosum, retries)
+	if sess, ok := sessions[id]; ok {
+		return sess, nil
+	}
+
+	creds := credentials.NewSharedCredentials("", profile)
+	switch {
+	case job.Anonymous:
+		creds = credentials.AnonymousCredentials
+	case job.AccessKey != "":
+		creds = credentials.NewStaticCredentials(job.AccessKey, job.SecretKey, "")
+	case *localS3 && job.Endpoint == "":
+		creds = credentials.NewStaticCredentials("local", "local", "")
+	}
+
+	config := aws.NewConfig().
+		WithCredentials(creds).
+		WithEndpoint(endpoint).
+		WithRegion(region).
+		WithDisableSSL(nossl).
+		WithMaxRetries(retries).
+		WithDisableComputeChecksums(nosum).
+		WithS3DisableContentMD5Validation(nomd5).
+		WithS3ForcePathStyle(pathstyle)
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions[id] = sess
+	return sess, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// versionCycle are the rounds after every key has its versions, a cycle ends
+// with as many versions per key as it started with.
+var versionCycle = []string{"get_latest", "get_version", "listversions", "put_version", "delete_version"}
+
+// keyVersions are the versions of a key a job wrote and still knows about,
+// the oldest first.
+type keyVersions struct {
+	ids     []string
+	written int
+	cycle   int
+	mu      sync.Mutex
+}
+
+// rounds is how often a job without duration visits each of its keys.
+func (job *Job) rounds() int64 {
+	if job.Operation == "versions" {
+		return int64(job.keepVersions + len(versionCycle))
+	}
+
+	return 1
+}
+
+func (job *Job) keyVersions(filename string) *keyVersions {
+	job.versionsMu.Lock()
+	defer job.versionsMu.Unlock()
+	if job.versionIds == nil {
+		job.versionIds = make(map[string]*keyVersions)
+	}
+
+	k, ok := job.versionIds[filename]
+	if !ok {
+		k = &keyVersions{}
+		job.versionIds[filename] = k
+	}
+
+	return k
+}
+
+// versions makes one request on a key of a versioned bucket per call. The
+// first rounds over the keyspace write Versions versions of every key, the
+// following rounds go through versionCycle. The requests on a key are made
+// one after the other, the versions it keeps are left for later jobs.
+func (job *Job) versions(filename string) Result {
+	k := job.keyVersions(filename)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	step := "put_version"
+	if len(k.ids) >= job.keepVersions {
+		step = versionCycle[k.cycle%len(versionCycle)]
+		k.cycle++
+	}
+
+	switch step {
+	case "get_latest":
+		t := time.Now()
+		r := job.getVersion(step, filename, "")
+		latest := k.ids[len(k.ids)-1]
+		if r.Err == "ok" && r.VersionId != latest {
+			return job.failed(step, filename, t, errVersion, fmt.Sprintf("Latest version of %q in %q is %s, expected %s", filename, job.Bucket, r.VersionId, latest))
+		}
+
+		return r
+	case "get_version":
+		return job.getVersion(step, filename, k.ids[rand.Intn(len(k.ids))])
+	case "listversions":
+		return job.listVersions(filename)
+	case "delete_version":
+		r := job.deleteVersion(filename, k.ids[0])
+		if r.Err == "ok" {
+			k.ids = k.ids[1:]
+		}
+
+		return r
+	}
+
+	r := job.putVersion(filename, k.written)
+	k.written++
+	if r.Err == "ok" {
+		k.ids = append(k.ids, r.VersionId)
+	}
+
+	return r
+}
+
+// Every version gets a payload of its own.
+func (job *Job) putVersion(filename string, v int) Result {
+	t := time.Now()
+	o := NewObjectInputStream(job.sizes.Size(), splitmix(payloadSeed(job.Seed, job.Bucket, filename)+uint64(v)), job.payload)
+	algorithm, key := job.customerKey(filename)
+	out, err := job.svc.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(job.Bucket),
+		Key:                  aws.String(filename),
+		Body:                 o,
+		Metadata:             job.metadata(nil),
+		ServerSideEncryption: job.serverSideEncryption(),
+		SSEKMSKeyId:          optional(job.KmsKeyId),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+		StorageClass:         optional(job.StorageClass),
+		ACL:                  optional(job.ACL),
+		ContentType:          optional(job.ContentType),
+		Tagging:              optional(job.Tagging),
+	})
+
+	if err != nil {
+		return job.failed("put_version", filename, t, err, fmt.Sprintf("Unable to upload %q to %q, %v", filename, job.Bucket, err))
+	}
+
+	if aws.StringValue(out.VersionId) == "" {
+		return job.failed("put_version", filename, t, errVersion, fmt.Sprintf("No version id for %q in %q, is versioning enabled?", filename, job.Bucket))
+	}
+
+	r := job.request("put_version", filename, bytesToUnits(o.Size), t)
+	r.Bytes = o.Size
+	r.VersionId = aws.StringValue(out.VersionId)
+	return r
+}
+
+// getVersion reads the given version of an object or the latest if version is
+// empty.
+func (job *Job) getVersion(op string, filename string, version string) Result {
+	t := time.Now()
+	algorithm, key := job.customerKey(filename)
+	out, err := job.svc.GetObject(&s3.GetObjectInput{
+		Bucket:               aws.String(job.Bucket),
+		Key:                  aws.String(filename),
+		VersionId:            optional(version),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+	})
+
+	if err != nil {
+		return job.failed(op, filename, t, err, fmt.Sprintf("Unable to download version %q of %q from %q, %v", version, filename, job.Bucket, err))
+	}
+	defer out.Body.Close()
+
+	n, err := io.Copy(ioutil.Discard, out.Body)
+	if err != nil {
+		return job.failed(op, filename, t, err, fmt.Sprintf("Unable to download version %q of %q from %q, %v", version, filename, job.Bucket, err))
+	}
+
+	r := job.request(op, filename, bytesToUnits(n), t)
+	r.Bytes = n
+	r.VersionId = aws.StringValue(out.VersionId)
+	return r
+}
+
+func (job *Job) listVersions(filename string) Result {
+	t := time.Now()
+	var versions int64
+	err := job.svc.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(job.Bucket),
+		Prefix: aws.String(filename),
+	}, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+		for _, v := range page.Versions {
+			if aws.StringValue(v.Key) == filename {
+				versions++
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return job.failed("listversions", filename, t, err, fmt.Sprintf("Unable to list the versions of %q in %q, %v", filename, job.Bucket, err))
+	}
+
+	r := job.request("listversions", filename, fmt.Sprintf("%dversions", versions), t)
+	r.Keys = versions
+	return r
+}
+
+func (job *Job) deleteVersion(filename string, version string) Result {
+	t := time.Now()
+	_, err := job.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:    aws.String(job.Bucket),
+		Key:       aws.String(filename),
+		VersionId: aws.String(version),
+	})
+
+	if err != nil {
+		return job.failed("delete_version", filename, t, err, fmt.Sprintf("Unable to delete version %s of %q from %q, %v", version, filename, job.Bucket, err))
+	}
+
+	r := job.request("delete_version", filename, "", t)
+	r.VersionId = version
+	return r
+}
+
+// enableVersioning turns on versioning of the bucket of a job with versioning.
+func (job *Job) enableVersioning() {
+	_, err := job.svc.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket: aws.String(job.Bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(s3.BucketVersioningStatusEnabled),
+		},
+	})
+
+	if err != nil {
+		fmt.Printf("Unable to enable versioning on %q, %v\n", job.Bucket, err)
+	}
+}
+
+// checkVersioning warns if the bucket of a versions job is not versioned.
+func (job *Job) checkVersioning() {
+	out, err := job.svc.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String(job.Bucket)})
+	if err != nil {
+		fmt.Printf("Unable to get the versioning of %q, %v\n", job.Bucket, err)
+		return
+	}
+
+	if aws.StringValue(out.Status) != s3.BucketVersioningStatusEnabled {
+		fmt.Printf("Versioning is not enabled on %q, the versions operations will fail, set versioning to true\n", job.Bucket)
+	}
+}